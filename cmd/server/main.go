@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -18,6 +22,8 @@ import (
 	"github.com/S0rgi/Gainly_Avatars/internal/clients"
 	"github.com/S0rgi/Gainly_Avatars/internal/config"
 	"github.com/S0rgi/Gainly_Avatars/internal/handlers"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	"github.com/S0rgi/Gainly_Avatars/internal/metrics"
 	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
 	"github.com/S0rgi/Gainly_Avatars/internal/services"
 )
@@ -57,28 +63,82 @@ func main() {
 	}
 	defer grpcClient.Close()
 
-	redisClient, err := clients.NewRedisClient(cfg.RedisURL)
+	metadataStore, err := newMetadataStore(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create Redis client: %v", err)
+		log.Fatalf("Failed to create metadata store: %v", err)
 	}
-	defer redisClient.Close()
+	defer metadataStore.Close()
 
-	r2Client, err := clients.NewR2Client(
-		cfg.R2AccountID,
-		cfg.R2AccessKeyID,
-		cfg.R2SecretKey,
-		cfg.R2BucketName,
-		cfg.R2Endpoint,
-	)
+	storage, err := newBlobStorage(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create R2 client: %v", err)
+		log.Fatalf("Failed to create storage backend: %v", err)
+	}
+
+	encoder, err := imaging.NewEncoder(cfg.AvatarOutputFormat, cfg.AvatarJPEGQuality, cfg.AvatarWebPQuality)
+	if err != nil {
+		log.Fatalf("Invalid avatar output settings: %v", err)
+	}
+
+	defaultStyle, err := imaging.ParsePlaceholderStyle(cfg.DefaultAvatarStyle)
+	if err != nil {
+		log.Fatalf("Invalid default avatar settings: %v", err)
+	}
+
+	fetcher := clients.NewRemoteFetcher(clients.RemoteFetcherConfig{
+		AllowedSchemes:       cfg.RemoteFetchAllowedSchemes,
+		AllowedHosts:         cfg.RemoteFetchAllowedHosts,
+		AllowPrivateNetworks: cfg.RemoteFetchAllowPrivate,
+		MaxRedirects:         cfg.RemoteFetchMaxRedirects,
+		ConnectTimeout:       cfg.RemoteFetchConnectTimeout,
+		Timeout:              cfg.RemoteFetchTimeout,
+		MaxBytes:             services.MaxAvatarSize,
+	})
+
+	importers, err := newImporters(cfg)
+	if err != nil {
+		log.Fatalf("Invalid avatar import settings: %v", err)
+	}
+
+	urlStrategy, err := services.ParseURLStrategy(cfg.AvatarURLStrategy)
+	if err != nil {
+		log.Fatalf("Invalid avatar URL settings: %v", err)
+	}
+	// Ключ подписи нужен стратегиям public и proxy. Без явного секрета ссылки на
+	// аватарки friends и private перестают работать после перезапуска
+	// и не принимаются другими экземплярами
+	urlSecret := cfg.AvatarURLSecret
+	if urlStrategy != services.URLStrategyPresigned {
+		urlSecret, err = secretOrRandom("AVATAR_URL_SECRET", cfg.AvatarURLSecret)
+		if err != nil {
+			log.Fatalf("Invalid avatar URL settings: %v", err)
+		}
+	}
+	urlOptions := services.URLOptions{
+		Strategy:       urlStrategy,
+		PublicBaseURL:  cfg.AvatarPublicBaseURL,
+		ServiceBaseURL: cfg.PublicBaseURL,
+		PresignExpiry:  cfg.AvatarURLExpiry,
+		SigningSecret:  urlSecret,
+	}
+	if err := urlOptions.Validate(); err != nil {
+		log.Fatalf("Invalid avatar URL settings: %v", err)
 	}
 
 	// Создаем сервисы
-	avatarService := services.NewAvatarService(r2Client, redisClient)
+	retention := services.RetentionOptions{
+		HistoryDepth: cfg.AvatarHistoryDepth,
+		DeleteGrace:  cfg.AvatarDeleteGrace,
+	}
+	avatarService := services.NewAvatarService(storage, metadataStore, encoder, defaultStyle, fetcher, importers, urlOptions, retention, grpcClient)
+
+	// Фоновая очистка истекших загрузок: отмена multipart и удаление временных объектов
+	purgerCtx, stopPurger := context.WithCancel(context.Background())
+	go avatarService.RunUploadPurger(purgerCtx, cfg.UploadPurgeInterval)
+	// Окончательное удаление аватарок, срок восстановления которых истек
+	go avatarService.RunDeletionPurger(purgerCtx, cfg.AvatarPurgeInterval)
 
 	// Создаем handlers
-	handlers := handlers.NewHandlers(avatarService)
+	handlers := handlers.NewHandlers(avatarService, cfg.BatchMaxSize)
 
 	// Настраиваем роутер
 	router := mux.NewRouter()
@@ -92,14 +152,51 @@ func main() {
 	// Применяем middleware для аутентификации ко всем API routes
 	// (GetAvatarsByUsernames пропускается внутри middleware)
 	api.Use(middleware.AuthMiddleware(grpcClient))
+	// Если username из токена сменился, аватарки переносятся на новый username
+	api.Use(handlers.SyncUsername)
 
 	// Avatar routes
 	api.HandleFunc("/avatar", handlers.AddAvatar).Methods("POST")
 	api.HandleFunc("/avatar", handlers.GetAvatar).Methods("GET")
 	api.HandleFunc("/avatars", handlers.GetAvatarsByUsernames).Methods("POST")
+	api.HandleFunc("/avatar/by-id/{id}", handlers.GetAvatarByUserID).Methods("GET")
+	api.HandleFunc("/avatars/by-id", handlers.GetAvatarsByUserIDs).Methods("POST")
 	api.HandleFunc("/avatar/me", handlers.GetMyAvatar).Methods("GET")
 	api.HandleFunc("/avatar/me", handlers.DeleteMyAvatar).Methods("DELETE")
+	api.HandleFunc("/avatar/me/restore", handlers.RestoreMyAvatar).Methods("POST")
+	api.HandleFunc("/avatar/me/visibility", handlers.SetAvatarVisibility).Methods("PUT")
+	api.HandleFunc("/avatar/history", handlers.GetAvatarHistory).Methods("GET")
+	api.HandleFunc("/avatar/history/{guid}/restore", handlers.RestoreAvatarVersion).Methods("POST")
 	api.HandleFunc("/avatar/url", handlers.UploadAvatarFromURL).Methods("POST")
+	api.HandleFunc("/avatar/upload-url", handlers.CreateUploadURL).Methods("POST")
+	api.HandleFunc("/avatar/complete", handlers.CompleteUpload).Methods("POST")
+	api.HandleFunc("/avatar/tus", handlers.TusOptions).Methods("OPTIONS")
+	api.HandleFunc("/avatar/tus", handlers.TusCreate).Methods("POST")
+	api.HandleFunc("/avatar/tus/{id}", handlers.TusHead).Methods("HEAD")
+	api.HandleFunc("/avatar/tus/{id}", handlers.TusPatch).Methods("PATCH")
+	api.HandleFunc("/avatar/tus/{id}", handlers.TusDelete).Methods("DELETE")
+	api.HandleFunc("/avatar/import/gravatar", handlers.ImportGravatar).Methods("POST")
+	api.HandleFunc("/avatar/import/oauth", handlers.ImportOAuthAvatar).Methods("POST")
+
+	// Содержимое аватарки по username без аутентификации (для <img src>)
+	router.HandleFunc("/avatars/{username}", handlers.ServeAvatar).Methods("GET", "HEAD")
+	router.HandleFunc("/avatars/{username}/{size:[0-9]+}", handlers.ServeAvatar).Methods("GET", "HEAD")
+	// Стабильный адрес аватарки с перенаправлением в хранилище или CDN
+	router.HandleFunc("/u/{username}.jpg", handlers.RedirectAvatar).Methods("GET", "HEAD")
+
+	// События UserService о смене username и импорт из Telegram по подтвержденной
+	// привязке; без секрета маршруты отключены
+	if cfg.UserEventsSecret != "" {
+		events := router.PathPrefix("/internal").Subrouter()
+		events.Use(middleware.ServiceAuthMiddleware(cfg.UserEventsSecret))
+		events.HandleFunc("/users/rename", handlers.RenameUser).Methods("POST")
+		events.HandleFunc("/users/import/telegram", handlers.ImportTelegramAvatar).Methods("POST")
+	}
+
+	// Локальное хранилище раздает файлы по подписанным ссылкам
+	if localStorage, ok := storage.(*clients.LocalStorage); ok {
+		router.PathPrefix(clients.LocalStorageRoute).Handler(localStorage).Methods("GET", "HEAD", "PUT")
+	}
 
 	// Swagger JSON - загружаем из файла (должен быть перед Swagger UI)
 	router.PathPrefix("/swagger/doc.json").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -142,6 +239,9 @@ func main() {
 		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
 	})
 
+	// Метрики (JSON в формате expvar)
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	// Health check
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -150,8 +250,9 @@ func main() {
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"}, // или "https://your-frontend.com"
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   append([]string{"Authorization", "Content-Type", "Range"}, tusRequestHeaders...),
+		ExposedHeaders:   append([]string{"ETag", "Content-Range", "Accept-Ranges"}, tusResponseHeaders...),
 		AllowCredentials: true,
 	}).Handler(router)
 
@@ -179,6 +280,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopPurger()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -189,3 +291,140 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// Заголовки протокола tus для CORS: ответы должны быть доступны браузерному клиенту
+var (
+	tusRequestHeaders  = []string{"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length"}
+	tusResponseHeaders = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires", "Avatar-Guid"}
+)
+
+// newMetadataStore создает хранилище метаданных согласно METADATA_BACKEND (redis, sql, memory).
+// Для sql при METADATA_REDIS_CACHE=true перед базой ставится Redis как read-through кэш
+func newMetadataStore(cfg *config.Config) (clients.MetadataStore, error) {
+	switch cfg.MetadataBackend {
+	case "redis":
+		return clients.NewRedisClient(cfg.RedisURL)
+	case "sql":
+		sqlStore, err := clients.NewSQLMetadataStore(cfg.SQLDriver, cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if !cfg.MetadataRedisCache {
+			return sqlStore, nil
+		}
+		cache, err := clients.NewMetadataCache(cfg.RedisURL, cfg.MetadataCacheTTL, cfg.MetadataCacheNegativeTTL)
+		if err != nil {
+			sqlStore.Close()
+			return nil, err
+		}
+		return clients.NewCachedMetadataStore(sqlStore, cache), nil
+	case "memory":
+		return clients.NewMemoryMetadataStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown metadata backend: %s", cfg.MetadataBackend)
+	}
+}
+
+// secretOrRandom возвращает value или, если секрет name не задан, случайный секрет
+func secretOrRandom(name, value string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	log.Printf("%s is not set, generating a random one", name)
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate %s: %w", name, err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// newBlobStorage создает хранилище файлов согласно STORAGE_BACKEND (r2, local, memory)
+func newBlobStorage(cfg *config.Config) (clients.BlobStorage, error) {
+	switch cfg.StorageBackend {
+	case "r2":
+		return clients.NewR2Client(
+			cfg.R2AccountID,
+			cfg.R2AccessKeyID,
+			cfg.R2SecretKey,
+			cfg.R2BucketName,
+			cfg.R2Endpoint,
+		)
+	case "local":
+		// Без явного секрета ссылки перестают работать после перезапуска
+		secret, err := secretOrRandom("LOCAL_STORAGE_SECRET", cfg.LocalStorageSecret)
+		if err != nil {
+			return nil, err
+		}
+		return clients.NewLocalStorage(cfg.LocalStorageDir, cfg.PublicBaseURL, secret)
+	case "memory":
+		return clients.NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+	}
+}
+
+// newImporters создает клиенты импорта аватарок из внешних сервисов
+func newImporters(cfg *config.Config) (services.Importers, error) {
+	var importers services.Importers
+
+	// Импорт из Telegram включается, если задан токен бота
+	if cfg.TelegramBotToken != "" {
+		importers.Telegram = clients.NewTelegramClient(cfg.TelegramAPIBaseURL, cfg.TelegramBotToken, cfg.RemoteFetchTimeout, services.MaxAvatarSize)
+		if cfg.UserEventsSecret == "" {
+			log.Printf("TELEGRAM_BOT_TOKEN is set, but Telegram import is disabled without USER_EVENTS_SECRET")
+		}
+	}
+
+	if cfg.GravatarEnabled {
+		fetcher, err := newProviderFetcher(cfg, cfg.GravatarBaseURL)
+		if err != nil {
+			return importers, err
+		}
+		importers.Gravatar, err = clients.NewGravatarClient(cfg.GravatarBaseURL, cfg.GravatarHash, fetcher)
+		if err != nil {
+			return importers, err
+		}
+	}
+
+	if len(cfg.OAuthAvatarProviders) > 0 {
+		baseURLs := make([]string, 0, len(cfg.OAuthAvatarProviders))
+		for _, baseURL := range cfg.OAuthAvatarProviders {
+			baseURLs = append(baseURLs, baseURL)
+		}
+		fetcher, err := newProviderFetcher(cfg, baseURLs...)
+		if err != nil {
+			return importers, err
+		}
+		importers.OAuth, err = clients.NewOAuthAvatarClient(cfg.OAuthAvatarProviders, fetcher)
+		if err != nil {
+			return importers, err
+		}
+	}
+
+	return importers, nil
+}
+
+// newProviderFetcher создает RemoteFetcher, которому разрешены только схемы и хосты
+// базовых URL провайдера. Остальные ограничения как у загрузки по URL
+func newProviderFetcher(cfg *config.Config, baseURLs ...string) (*clients.RemoteFetcher, error) {
+	var schemes, hosts []string
+	for _, baseURL := range baseURLs {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Scheme == "" || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid provider base URL: %q", baseURL)
+		}
+		schemes = append(schemes, u.Scheme)
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return clients.NewRemoteFetcher(clients.RemoteFetcherConfig{
+		AllowedSchemes:       schemes,
+		AllowedHosts:         hosts,
+		AllowPrivateNetworks: cfg.RemoteFetchAllowPrivate,
+		MaxRedirects:         cfg.RemoteFetchMaxRedirects,
+		ConnectTimeout:       cfg.RemoteFetchConnectTimeout,
+		Timeout:              cfg.RemoteFetchTimeout,
+		MaxBytes:             services.MaxAvatarSize,
+	}), nil
+}
@@ -31,7 +31,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает URL аватарки указанного пользователя",
+                "description": "Возвращает URL аватарки указанного пользователя. Если пользователь ничего не загружал или скрыл аватарку от текущего пользователя (видимость friends или private), возвращается сгенерированная аватарка по умолчанию (is_default=true)",
                 "produces": [
                     "application/json"
                 ],
@@ -46,11 +46,1128 @@ const docTemplate = `{
                         "name": "username",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия",
+                        "name": "size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "URL аватарки",
+                        "schema": {
+                            "$ref": "#/definitions/services.AvatarURL"
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Аватарка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Загружает новую аватарку для текущего пользователя. Допустимые форматы: JPEG, PNG, WebP, GIF (определяются по содержимому файла). Изображение обрезается до квадрата: по заданной области, вокруг точки фокуса или по центру",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Загрузить аватарку",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Файл аватарки",
+                        "name": "avatar",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Левый край области обрезки в пикселях",
+                        "name": "crop_x",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Верхний край области обрезки в пикселях",
+                        "name": "crop_y",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Ширина области обрезки в пикселях",
+                        "name": "crop_width",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Высота области обрезки в пикселях",
+                        "name": "crop_height",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Точка фокуса по горизонтали (0..1), если область не задана",
+                        "name": "focal_x",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Точка фокуса по вертикали (0..1), если область не задана",
+                        "name": "focal_y",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "GUID загруженной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Файл слишком большой",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Неподдерживаемый формат",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Поврежденное изображение или недопустимые размеры",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/by-id/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает URL аватарки пользователя по Id из UserService, так же как GET /avatar по username. Если пользователь ничего не загружал или скрыл аватарку от текущего пользователя, возвращается аватарка по умолчанию (is_default=true)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Получить аватарку по ID пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия",
+                        "name": "size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "URL аватарки",
+                        "schema": {
+                            "$ref": "#/definitions/services.AvatarURL"
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь или аватарка не найдены",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/complete": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Проверяет загруженный по ссылке файл (размер, Content-Type, содержимое) и сохраняет его как аватарку",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Завершить прямую загрузку",
+                "parameters": [
+                    {
+                        "description": "ID загрузки",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CompleteUploadRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "GUID загруженной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Загрузка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Файл еще не загружен",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "410": {
+                        "description": "Ссылка для загрузки истекла",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Неподдерживаемый формат",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Файл не совпадает с заявленным или поврежден",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/history": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает предыдущие аватарки текущего пользователя, начиная с последней. Количество хранимых аватарок задается AVATAR_HISTORY_DEPTH",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "История аватарок",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия",
+                        "name": "size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Предыдущие аватарки",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/services.AvatarVersion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/history/{guid}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Делает аватарку из истории текущей. Текущая аватарка переносится в историю",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Восстановить предыдущую аватарку",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "GUID аватарки из истории",
+                        "name": "guid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "GUID восстановленной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Аватарки нет в истории",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/import/gravatar": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Загружает Gravatar, привязанный к email пользователя (SHA-256 или MD5 хэш согласно GRAVATAR_HASH)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Импортировать аватарку из Gravatar",
+                "responses": {
+                    "200": {
+                        "description": "GUID загруженной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "У пользователя нет email или ошибка загрузки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Gravatar не найден",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Поврежденное изображение или недопустимые размеры",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Импорт из Gravatar отключен",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/import/oauth": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Загружает картинку профиля (например picture из Google userinfo). URL должен находиться под базовым URL провайдера из OAUTH_AVATAR_PROVIDERS",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Импортировать аватарку OAuth провайдера",
+                "parameters": [
+                    {
+                        "description": "Провайдер и URL картинки",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ImportOAuthAvatarRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "GUID загруженной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Неизвестный провайдер, чужой URL или ошибка загрузки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Файл слишком большой",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Неподдерживаемый формат",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Поврежденное изображение или недопустимые размеры",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Импорт OAuth аватарок не настроен",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает URL аватарки текущего пользователя или аватарку по умолчанию (is_default=true)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Получить свою аватарку",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия",
+                        "name": "size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "URL аватарки",
+                        "schema": {
+                            "$ref": "#/definitions/services.AvatarURL"
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Аватарка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет аватарку текущего пользователя. Аватарка сразу перестает отдаваться, но хранится AVATAR_DELETE_GRACE_SECONDS и может быть восстановлена через /avatar/me/restore",
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Удалить свою аватарку",
+                "responses": {
+                    "204": {
+                        "description": "Аватарка успешно удалена"
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Аватарка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/me/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Восстанавливает последнюю удаленную аватарку текущего пользователя, если срок восстановления не истек. Загруженная после удаления аватарка переносится в историю",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Восстановить удаленную аватарку",
+                "responses": {
+                    "200": {
+                        "description": "GUID восстановленной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Нет удаленной аватарки или срок восстановления истек",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/me/visibility": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Задает, кому видна аватарка: public - всем, friends - только друзьям (CheckFriendship), private - только владельцу. Остальным возвращается аватарка по умолчанию. Настройка сохраняется для следующих загрузок",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "avatars"
+                ],
+                "summary": "Изменить видимость аватарки",
+                "parameters": [
+                    {
+                        "description": "Видимость",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SetAvatarVisibilityRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Новая видимость",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Аватарка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/avatar/tus": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает загрузку размером Upload-Length и возвращает ее адрес в Location. Upload-Metadata (пары \"ключ base64\", через запятую) может содержать filename и параметры обрезки crop_x, crop_y, crop_width, crop_height или focal_x, focal_y. Незавершенная загрузка удаляется через 24 часа",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Начать возобновляемую загрузку (tus)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Версия протокола: 1.0.0",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер файла в байтах",
+                        "name": "Upload-Length",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Метаданные загрузки",
+                        "name": "Upload-Metadata",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Location, Upload-Expires в заголовках"
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Неподдерживаемая версия протокола",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Файл слишком большой",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "options": {
+                "description": "Возвращает версию протокола tus, расширения и максимальный размер файла",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Возможности возобновляемой загрузки (tus)",
+                "responses": {
+                    "204": {
+                        "description": "Tus-Version, Tus-Extension, Tus-Max-Size в заголовках"
+                    }
+                }
+            }
+        },
+        "/avatar/tus/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет загрузку и все полученные данные",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Отменить возобновляемую загрузку (tus)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID загрузки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Версия протокола: 1.0.0",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Загрузка удалена"
+                    },
+                    "401": {
+                        "description": "Не авторизован",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Загрузка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Неподдерживаемая версия протокола",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "head": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает число полученных байт в Upload-Offset, с которого нужно продолжить загрузку",
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Состояние возобновляемой загрузки (tus)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID загрузки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Версия протокола: 1.0.0",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires в заголовках"
+                    },
+                    "401": {
+                        "description": "Не авторизован"
+                    },
+                    "404": {
+                        "description": "Загрузка не найдена"
+                    },
+                    "410": {
+                        "description": "Загрузка истекла"
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Дописывает тело запроса с позиции Upload-Offset, которая должна совпадать с текущим смещением загрузки. После получения всего файла он проверяется и сохраняется как аватарка, GUID возвращается в заголовке Avatar-Guid",
+                "consumes": [
+                    "application/offset+octet-stream"
+                ],
+                "tags": [
+                    "tus"
+                ],
+                "summary": "Загрузить часть файла (tus)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID загрузки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Версия протокола: 1.0.0",
+                        "name": "Tus-Resumable",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение, с которого передаются данные",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "URL аватарки",
+                    "204": {
+                        "description": "Upload-Offset (и Avatar-Guid после последней части) в заголовках"
+                    },
+                    "400": {
+                        "description": "Ошибка валидации",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -58,8 +1175,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "400": {
-                        "description": "Ошибка валидации",
+                    "401": {
+                        "description": "Не авторизован",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -68,7 +1185,52 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Аватарка не найдена",
+                        "description": "Загрузка не найдена",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Смещение не совпадает",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "410": {
+                        "description": "Загрузка истекла",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Неподдерживаемая версия протокола",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Неверный Content-Type или формат файла",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Файл поврежден или неверная обрезка",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -86,16 +1248,18 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/avatar/upload-url": {
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Загружает новую аватарку для текущего пользователя",
+                "description": "Возвращает presigned PUT URL. Клиент загружает файл по ссылке с указанным Content-Type и точным размером, затем вызывает /avatar/complete. Ссылка действует 15 минут",
                 "consumes": [
-                    "multipart/form-data"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
@@ -103,24 +1267,23 @@ const docTemplate = `{
                 "tags": [
                     "avatars"
                 ],
-                "summary": "Загрузить аватарку",
+                "summary": "Получить ссылку для прямой загрузки",
                 "parameters": [
                     {
-                        "type": "file",
-                        "description": "Файл аватарки",
-                        "name": "avatar",
-                        "in": "formData",
-                        "required": true
+                        "description": "Content-Type и размер файла",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateUploadURLRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "GUID загруженной аватарки",
+                        "description": "Ссылка для загрузки",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/services.UploadURL"
                         }
                     },
                     "400": {
@@ -141,6 +1304,24 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "413": {
+                        "description": "Файл слишком большой",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Неподдерживаемый формат",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Внутренняя ошибка сервера",
                         "schema": {
@@ -153,24 +1334,47 @@ const docTemplate = `{
                 }
             }
         },
-        "/avatar/me": {
-            "get": {
+        "/avatar/url": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает URL аватарки текущего пользователя",
+                "description": "Загружает аватарку из внешнего URL (например Telegram File API). Разрешены только схемы и хосты из REMOTE_FETCH_ALLOWED_SCHEMES и REMOTE_FETCH_ALLOWED_HOSTS, адреса локальных сетей запрещены",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "avatars"
                 ],
-                "summary": "Получить свою аватарку",
+                "summary": "Загрузить аватарку по URL",
+                "parameters": [
+                    {
+                        "description": "URL изображения",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UploadAvatarFromURLRequest"
+                        }
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "URL аватарки",
+                        "description": "GUID загруженной аватарки",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка валидации, запрещенный URL или ошибка загрузки файла",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -187,34 +1391,17 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "404": {
-                        "description": "Аватарка не найдена",
+                    "413": {
+                        "description": "Файл слишком большой",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
                                 "type": "string"
                             }
                         }
-                    }
-                }
-            },
-            "delete": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Удаляет аватарку текущего пользователя",
-                "tags": [
-                    "avatars"
-                ],
-                "summary": "Удалить свою аватарку",
-                "responses": {
-                    "204": {
-                        "description": "Аватарка успешно удалена"
                     },
-                    "401": {
-                        "description": "Не авторизован",
+                    "415": {
+                        "description": "Неподдерживаемый формат",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -222,8 +1409,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "404": {
-                        "description": "Аватарка не найдена",
+                    "422": {
+                        "description": "Поврежденное изображение или недопустимые размеры",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -232,7 +1419,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Внутренняя ошибка сервера",
+                        "description": "Ошибка хранения",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -243,14 +1430,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/avatar/url": {
+        "/avatars": {
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Загружает аватарку из внешнего URL (например Telegram File API)",
+                "description": "Возвращает URL аватарок для списка пользователей (не более AVATARS_BATCH_MAX_SIZE за запрос). Для пользователей без загрузки возвращается аватарка по умолчанию (is_default=true). Аутентификация необязательна: без токена аватарки с видимостью friends и private заменяются аватаркой по умолчанию",
                 "consumes": [
                     "application/json"
                 ],
@@ -260,25 +1447,25 @@ const docTemplate = `{
                 "tags": [
                     "avatars"
                 ],
-                "summary": "Загрузить аватарку по URL",
+                "summary": "Получить аватарки по username",
                 "parameters": [
                     {
-                        "description": "URL изображения",
+                        "description": "Список username",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.UploadAvatarFromURLRequest"
+                            "$ref": "#/definitions/handlers.GetAvatarsRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "GUID загруженной аватарки",
+                        "description": "Карта username -\u003e URL",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
-                                "type": "string"
+                                "$ref": "#/definitions/services.AvatarURL"
                             }
                         }
                     },
@@ -291,17 +1478,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "401": {
-                        "description": "Не авторизован",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
-                    },
                     "500": {
-                        "description": "Ошибка загрузки или хранения",
+                        "description": "Внутренняя ошибка сервера",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -312,9 +1490,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/avatars": {
+        "/avatars/by-id": {
             "post": {
-                "description": "Возвращает URL аватарок для списка пользователей",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает URL аватарок для списка ID пользователей из UserService (не более AVATARS_BATCH_MAX_SIZE за запрос), так же как POST /avatars по username. Неизвестные ID пропускаются; в UserService за запрос ищется не больше 10 ID, которых нет в индексе. Аутентификация необязательна: без токена аватарки с видимостью friends и private заменяются аватаркой по умолчанию",
                 "consumes": [
                     "application/json"
                 ],
@@ -324,25 +1507,25 @@ const docTemplate = `{
                 "tags": [
                     "avatars"
                 ],
-                "summary": "Получить аватарки по username",
+                "summary": "Получить аватарки по ID пользователей",
                 "parameters": [
                     {
-                        "description": "Список username",
+                        "description": "Список ID пользователей",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.GetAvatarsRequest"
+                            "$ref": "#/definitions/handlers.GetAvatarsByIDsRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Карта username -\u003e URL",
+                        "description": "Карта ID -\u003e URL",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
-                                "type": "string"
+                                "$ref": "#/definitions/services.AvatarURL"
                             }
                         }
                     },
@@ -369,9 +1552,70 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "handlers.CompleteUploadRequest": {
+            "type": "object",
+            "properties": {
+                "crop": {
+                    "description": "Crop область обрезки в пикселях исходного изображения",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/imaging.CropRect"
+                        }
+                    ]
+                },
+                "focal": {
+                    "description": "Focal точка фокуса (доли 0..1), если область не задана",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/imaging.FocalPoint"
+                        }
+                    ]
+                },
+                "upload_id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                }
+            }
+        },
+        "handlers.CreateUploadURLRequest": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "type": "string",
+                    "example": "image/jpeg"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 524288
+                }
+            }
+        },
+        "handlers.GetAvatarsByIDsRequest": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "42",
+                        "43"
+                    ]
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 128
+                }
+            }
+        },
         "handlers.GetAvatarsRequest": {
             "type": "object",
             "properties": {
+                "size": {
+                    "type": "integer",
+                    "example": 128
+                },
                 "usernames": {
                     "type": "array",
                     "items": {
@@ -384,14 +1628,160 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.ImportOAuthAvatarRequest": {
+            "type": "object",
+            "properties": {
+                "crop": {
+                    "description": "Crop область обрезки в пикселях исходного изображения",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/imaging.CropRect"
+                        }
+                    ]
+                },
+                "focal": {
+                    "description": "Focal точка фокуса (доли 0..1), если область не задана",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/imaging.FocalPoint"
+                        }
+                    ]
+                },
+                "picture_url": {
+                    "type": "string",
+                    "example": "https://lh3.googleusercontent.com/a/..."
+                },
+                "provider": {
+                    "type": "string",
+                    "example": "google"
+                }
+            }
+        },
+        "handlers.SetAvatarVisibilityRequest": {
+            "type": "object",
+            "properties": {
+                "visibility": {
+                    "type": "string",
+                    "enum": [
+                        "public",
+                        "friends",
+                        "private"
+                    ],
+                    "example": "friends"
+                }
+            }
+        },
         "handlers.UploadAvatarFromURLRequest": {
             "type": "object",
             "properties": {
+                "crop": {
+                    "description": "Crop область обрезки в пикселях исходного изображения",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/imaging.CropRect"
+                        }
+                    ]
+                },
+                "focal": {
+                    "description": "Focal точка фокуса (доли 0..1), если область не задана",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/imaging.FocalPoint"
+                        }
+                    ]
+                },
                 "url": {
                     "type": "string",
                     "example": "https://t.me/i/userpic/..."
                 }
             }
+        },
+        "imaging.CropRect": {
+            "type": "object",
+            "properties": {
+                "height": {
+                    "type": "integer"
+                },
+                "width": {
+                    "type": "integer"
+                },
+                "x": {
+                    "type": "integer"
+                },
+                "y": {
+                    "type": "integer"
+                }
+            }
+        },
+        "imaging.FocalPoint": {
+            "type": "object",
+            "properties": {
+                "x": {
+                    "type": "number"
+                },
+                "y": {
+                    "type": "number"
+                }
+            }
+        },
+        "services.AvatarURL": {
+            "type": "object",
+            "properties": {
+                "is_default": {
+                    "description": "IsDefault true, если пользователь ничего не загружал и отдается сгенерированная аватарка",
+                    "type": "boolean"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "services.AvatarVersion": {
+            "type": "object",
+            "properties": {
+                "guid": {
+                    "type": "string"
+                },
+                "mime_type": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "uploaded_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "services.UploadURL": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "headers": {
+                    "description": "Headers заголовки, которые клиент обязан передать в запросе загрузки",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "method": {
+                    "type": "string"
+                },
+                "upload_id": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -0,0 +1,305 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CachedMetadataStore read-through кэш (MetadataCache в Redis) перед основным
+// хранилищем метаданных (обычно SQL). Кэшируются поиск текущей аватарки по username
+// и метаданные аватарок. Источник истины - primary; ошибки кэша только логируются
+type CachedMetadataStore struct {
+	primary MetadataStore
+	cache   *MetadataCache
+}
+
+func NewCachedMetadataStore(primary MetadataStore, cache *MetadataCache) *CachedMetadataStore {
+	return &CachedMetadataStore{
+		primary: primary,
+		cache:   cache,
+	}
+}
+
+// GetGUIDByUserID читает текущую аватарку из primary
+func (c *CachedMetadataStore) GetGUIDByUserID(ctx context.Context, userID string) (string, error) {
+	return c.primary.GetGUIDByUserID(ctx, userID)
+}
+
+// SwapGUIDByUserID заменяет текущую аватарку в primary и сбрасывает кэш username пользователя
+func (c *CachedMetadataStore) SwapGUIDByUserID(ctx context.Context, userID, guid string) (string, error) {
+	oldGUID, err := c.primary.SwapGUIDByUserID(ctx, userID, guid)
+	if err != nil {
+		return "", err
+	}
+
+	c.invalidateUser(ctx, userID)
+	return oldGUID, nil
+}
+
+// DeleteAvatarMapping удаляет связь с текущей аватаркой из primary и сбрасывает кэш
+func (c *CachedMetadataStore) DeleteAvatarMapping(ctx context.Context, userID string) error {
+	if err := c.primary.DeleteAvatarMapping(ctx, userID); err != nil {
+		return err
+	}
+
+	c.invalidateUser(ctx, userID)
+	return nil
+}
+
+// GetGUIDByUsername получает GUID из кэша, при промахе - из primary
+func (c *CachedMetadataStore) GetGUIDByUsername(ctx context.Context, username string) (string, error) {
+	guids, err := c.GetGUIDsByUsernames(ctx, []string{username})
+	if err != nil {
+		return "", err
+	}
+	guid, ok := guids[username]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, username)
+	}
+	return guid, nil
+}
+
+// GetGUIDsByUsernames берет найденные в кэше связи, остальные догружает из primary.
+// Username без аватарки кэшируются как отсутствующие
+func (c *CachedMetadataStore) GetGUIDsByUsernames(ctx context.Context, usernames []string) (map[string]string, error) {
+	cached, err := c.cache.GUIDs(ctx, usernames)
+	if err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: batch cache lookup failed: %v", err)
+		cached = make(map[string]string)
+	}
+
+	result := make(map[string]string)
+	var missing []string
+	for _, username := range usernames {
+		guid, ok := cached[username]
+		if !ok {
+			missing = append(missing, username)
+		} else if guid != "" {
+			result[username] = guid
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	found, err := c.primary.GetGUIDsByUsernames(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	fill := make(map[string]string, len(missing))
+	for _, username := range missing {
+		fill[username] = found[username]
+		if guid, ok := found[username]; ok {
+			result[username] = guid
+		}
+	}
+	if err := c.cache.SetGUIDs(ctx, fill); err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: %v", err)
+	}
+
+	return result, nil
+}
+
+// GetAvatarMetadata получает метаданные из кэша, при промахе - из primary
+func (c *CachedMetadataStore) GetAvatarMetadata(ctx context.Context, guid string) (*AvatarMetadata, error) {
+	metadataMap, err := c.GetAvatarsMetadata(ctx, []string{guid})
+	if err != nil {
+		return nil, err
+	}
+	metadata, ok := metadataMap[guid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMetadataNotFound, guid)
+	}
+	return metadata, nil
+}
+
+// GetAvatarsMetadata берет найденные в кэше метаданные, остальные догружает из primary.
+// GUID без метаданных кэшируются как отсутствующие
+func (c *CachedMetadataStore) GetAvatarsMetadata(ctx context.Context, guids []string) (map[string]*AvatarMetadata, error) {
+	cached, err := c.cache.Metadata(ctx, guids)
+	if err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: batch metadata cache lookup failed: %v", err)
+		cached = make(map[string]*AvatarMetadata)
+	}
+
+	result := make(map[string]*AvatarMetadata)
+	var missing []string
+	for _, guid := range guids {
+		metadata, ok := cached[guid]
+		if !ok {
+			missing = append(missing, guid)
+		} else if metadata != nil {
+			result[guid] = metadata
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	found, err := c.primary.GetAvatarsMetadata(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	fill := make(map[string]*AvatarMetadata, len(missing))
+	for _, guid := range missing {
+		fill[guid] = found[guid]
+		if metadata, ok := found[guid]; ok {
+			result[guid] = metadata
+		}
+	}
+	if err := c.cache.SetMetadata(ctx, fill); err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: %v", err)
+	}
+
+	return result, nil
+}
+
+// SetAvatarMetadata записывает метаданные в primary и обновляет кэш
+func (c *CachedMetadataStore) SetAvatarMetadata(ctx context.Context, metadata *AvatarMetadata) error {
+	if err := c.primary.SetAvatarMetadata(ctx, metadata); err != nil {
+		return err
+	}
+
+	if err := c.cache.SetMetadata(ctx, map[string]*AvatarMetadata{metadata.GUID: metadata}); err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: failed to cache avatar metadata %s: %v", metadata.GUID, err)
+		c.invalidateMetadata(ctx, metadata.GUID)
+	}
+	return nil
+}
+
+// DeleteAvatarMetadata удаляет метаданные из primary и кэша
+func (c *CachedMetadataStore) DeleteAvatarMetadata(ctx context.Context, guid string) error {
+	if err := c.primary.DeleteAvatarMetadata(ctx, guid); err != nil {
+		return err
+	}
+
+	c.invalidateMetadata(ctx, guid)
+	return nil
+}
+
+// SetUsername записывает псевдоним в primary и сбрасывает кэш нового и прежнего username
+func (c *CachedMetadataStore) SetUsername(ctx context.Context, userID, username string) (string, error) {
+	previous, err := c.primary.SetUsername(ctx, userID, username)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.cache.DeleteUsernames(ctx, username, previous); err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: failed to evict username %s: %v", username, err)
+	}
+	return previous, nil
+}
+
+// GetUsernameByUserID читает индекс из primary
+func (c *CachedMetadataStore) GetUsernameByUserID(ctx context.Context, userID string) (string, error) {
+	return c.primary.GetUsernameByUserID(ctx, userID)
+}
+
+// GetUsernamesByUserIDs читает индекс из primary
+func (c *CachedMetadataStore) GetUsernamesByUserIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	return c.primary.GetUsernamesByUserIDs(ctx, userIDs)
+}
+
+// AcquireObject увеличивает счетчик ссылок в primary: счетчики не кэшируются
+func (c *CachedMetadataStore) AcquireObject(ctx context.Context, objectID string) (int64, error) {
+	return c.primary.AcquireObject(ctx, objectID)
+}
+
+// ReleaseObject уменьшает счетчик ссылок в primary
+func (c *CachedMetadataStore) ReleaseObject(ctx context.Context, objectID string) (int64, error) {
+	return c.primary.ReleaseObject(ctx, objectID)
+}
+
+// FinishObjectDeletion снимает метку удаления в primary
+func (c *CachedMetadataStore) FinishObjectDeletion(ctx context.Context, objectID string) error {
+	return c.primary.FinishObjectDeletion(ctx, objectID)
+}
+
+// PushAvatarHistory добавляет GUID в историю в primary: история не кэшируется
+func (c *CachedMetadataStore) PushAvatarHistory(ctx context.Context, userID, guid string, depth int) ([]string, error) {
+	return c.primary.PushAvatarHistory(ctx, userID, guid, depth)
+}
+
+// GetAvatarHistory читает историю из primary
+func (c *CachedMetadataStore) GetAvatarHistory(ctx context.Context, userID string) ([]string, error) {
+	return c.primary.GetAvatarHistory(ctx, userID)
+}
+
+// RemoveAvatarHistory удаляет GUID из истории в primary
+func (c *CachedMetadataStore) RemoveAvatarHistory(ctx context.Context, userID, guid string) error {
+	return c.primary.RemoveAvatarHistory(ctx, userID, guid)
+}
+
+// GetDeletedAvatar читает удаленную аватарку из primary: удаленные аватарки не кэшируются
+func (c *CachedMetadataStore) GetDeletedAvatar(ctx context.Context, userID string) (*DeletedAvatar, error) {
+	return c.primary.GetDeletedAvatar(ctx, userID)
+}
+
+// SetDeletedAvatar сохраняет удаленную аватарку в primary
+func (c *CachedMetadataStore) SetDeletedAvatar(ctx context.Context, deleted *DeletedAvatar) error {
+	return c.primary.SetDeletedAvatar(ctx, deleted)
+}
+
+// DeleteDeletedAvatar удаляет запись об удаленной аватарке из primary
+func (c *CachedMetadataStore) DeleteDeletedAvatar(ctx context.Context, userID string) error {
+	return c.primary.DeleteDeletedAvatar(ctx, userID)
+}
+
+// ListExpiredDeletions читает удаленные аватарки с истекшим сроком из primary
+func (c *CachedMetadataStore) ListExpiredDeletions(ctx context.Context, before time.Time, limit int) ([]*DeletedAvatar, error) {
+	return c.primary.ListExpiredDeletions(ctx, before, limit)
+}
+
+// GetPendingUpload читает незавершенную загрузку из primary: состояние загрузок не кэшируется
+func (c *CachedMetadataStore) GetPendingUpload(ctx context.Context, id string) (*PendingUpload, error) {
+	return c.primary.GetPendingUpload(ctx, id)
+}
+
+// SetPendingUpload сохраняет незавершенную загрузку в primary
+func (c *CachedMetadataStore) SetPendingUpload(ctx context.Context, upload *PendingUpload) error {
+	return c.primary.SetPendingUpload(ctx, upload)
+}
+
+// DeletePendingUpload удаляет незавершенную загрузку из primary
+func (c *CachedMetadataStore) DeletePendingUpload(ctx context.Context, id string) error {
+	return c.primary.DeletePendingUpload(ctx, id)
+}
+
+// ListExpiredUploads читает истекшие загрузки из primary
+func (c *CachedMetadataStore) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*PendingUpload, error) {
+	return c.primary.ListExpiredUploads(ctx, before, limit)
+}
+
+func (c *CachedMetadataStore) Close() error {
+	cacheErr := c.cache.Close()
+	if err := c.primary.Close(); err != nil {
+		return err
+	}
+	return cacheErr
+}
+
+// invalidateUser сбрасывает кэш username пользователя после смены его текущей аватарки.
+// Если username не удалось получить, кэш устареет через TTL
+func (c *CachedMetadataStore) invalidateUser(ctx context.Context, userID string) {
+	username, err := c.primary.GetUsernameByUserID(ctx, userID)
+	if errors.Is(err, ErrUserIDNotFound) {
+		return
+	}
+	if err == nil {
+		err = c.cache.DeleteUsernames(ctx, username)
+	}
+	if err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: failed to evict username of user %s: %v", userID, err)
+	}
+}
+
+func (c *CachedMetadataStore) invalidateMetadata(ctx context.Context, guid string) {
+	if err := c.cache.DeleteMetadata(ctx, guid); err != nil {
+		log.Printf("[METADATA-CACHE] WARNING: failed to evict avatar metadata %s: %v", guid, err)
+	}
+}
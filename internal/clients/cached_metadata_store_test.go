@@ -0,0 +1,176 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+const (
+	testCacheTTL         = time.Minute
+	testCacheNegativeTTL = 10 * time.Second
+)
+
+// newTestCachedStore создает CachedMetadataStore с кэшем в miniredis. Основное
+// хранилище возвращается, чтобы менять его в обход кэша
+func newTestCachedStore(t *testing.T) (*CachedMetadataStore, *MemoryMetadataStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	cache, err := NewMetadataCache("redis://"+server.Addr(), testCacheTTL, testCacheNegativeTTL)
+	if err != nil {
+		t.Fatalf("NewMetadataCache: %v", err)
+	}
+	primary := NewMemoryMetadataStore()
+	store := NewCachedMetadataStore(primary, cache)
+	t.Cleanup(func() { store.Close() })
+	return store, primary, server
+}
+
+func TestCachedMetadataStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	store, primary, server := newTestCachedStore(t)
+
+	if _, err := store.SetUsername(ctx, "1", "alice"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := store.SwapGUIDByUserID(ctx, "1", "g1"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if err := store.SetAvatarMetadata(ctx, &AvatarMetadata{GUID: "g1", UserID: "1", Username: "alice"}); err != nil {
+		t.Fatalf("SetAvatarMetadata: %v", err)
+	}
+	if guid, err := store.GetGUIDByUsername(ctx, "alice"); err != nil || guid != "g1" {
+		t.Fatalf("GetGUIDByUsername = %q, %v, want g1", guid, err)
+	}
+	if ttl := server.TTL(usernameCacheKey("alice")); ttl != testCacheTTL {
+		t.Fatalf("username cache TTL = %v, want %v", ttl, testCacheTTL)
+	}
+
+	// Изменения в обход кэша видны только после истечения TTL
+	if _, err := primary.SwapGUIDByUserID(ctx, "1", "g2"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if err := primary.SetAvatarMetadata(ctx, &AvatarMetadata{GUID: "g1", UserID: "1", Username: "alice", Visibility: AvatarVisibilityPrivate}); err != nil {
+		t.Fatalf("SetAvatarMetadata: %v", err)
+	}
+	if guid, _ := store.GetGUIDByUsername(ctx, "alice"); guid != "g1" {
+		t.Fatalf("GetGUIDByUsername = %q, want cached g1", guid)
+	}
+	if metadata, _ := store.GetAvatarMetadata(ctx, "g1"); metadata == nil || metadata.Visibility != "" {
+		t.Fatalf("GetAvatarMetadata = %+v, want cached metadata", metadata)
+	}
+
+	server.FastForward(testCacheTTL)
+	if guid, err := store.GetGUIDByUsername(ctx, "alice"); err != nil || guid != "g2" {
+		t.Fatalf("GetGUIDByUsername after TTL = %q, %v, want g2", guid, err)
+	}
+	if metadata, err := store.GetAvatarMetadata(ctx, "g1"); err != nil || metadata.Visibility != AvatarVisibilityPrivate {
+		t.Fatalf("GetAvatarMetadata after TTL = %+v, %v, want private", metadata, err)
+	}
+}
+
+func TestCachedMetadataStoreNegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	store, primary, server := newTestCachedStore(t)
+
+	if _, err := store.GetGUIDByUsername(ctx, "bob"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername(bob) error = %v, want ErrUsernameNotFound", err)
+	}
+	if _, err := store.GetAvatarMetadata(ctx, "g1"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Fatalf("GetAvatarMetadata(g1) error = %v, want ErrMetadataNotFound", err)
+	}
+	for _, key := range []string{usernameCacheKey("bob"), avatarCacheKey("g1")} {
+		if ttl := server.TTL(key); ttl != testCacheNegativeTTL {
+			t.Fatalf("%s TTL = %v, want %v", key, ttl, testCacheNegativeTTL)
+		}
+	}
+
+	// Промах кэшируется: появившиеся в обход кэша записи не видны до истечения negativeTTL
+	if _, err := primary.SetUsername(ctx, "2", "bob"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := primary.SwapGUIDByUserID(ctx, "2", "g1"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if err := primary.SetAvatarMetadata(ctx, &AvatarMetadata{GUID: "g1", UserID: "2", Username: "bob"}); err != nil {
+		t.Fatalf("SetAvatarMetadata: %v", err)
+	}
+	guids, err := store.GetGUIDsByUsernames(ctx, []string{"bob"})
+	if err != nil || len(guids) != 0 {
+		t.Fatalf("GetGUIDsByUsernames = %v, %v, want cached miss", guids, err)
+	}
+	if _, err := store.GetAvatarMetadata(ctx, "g1"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Fatalf("GetAvatarMetadata(g1) error = %v, want cached ErrMetadataNotFound", err)
+	}
+
+	server.FastForward(testCacheNegativeTTL)
+	if guid, err := store.GetGUIDByUsername(ctx, "bob"); err != nil || guid != "g1" {
+		t.Fatalf("GetGUIDByUsername after negative TTL = %q, %v, want g1", guid, err)
+	}
+	if _, err := store.GetAvatarMetadata(ctx, "g1"); err != nil {
+		t.Fatalf("GetAvatarMetadata after negative TTL: %v", err)
+	}
+}
+
+func TestCachedMetadataStoreInvalidation(t *testing.T) {
+	ctx := context.Background()
+	store, _, _ := newTestCachedStore(t)
+
+	// Кэшированный промах сбрасывается при загрузке аватарки
+	if _, err := store.SetUsername(ctx, "1", "alice"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := store.GetGUIDByUsername(ctx, "alice"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername error = %v, want ErrUsernameNotFound", err)
+	}
+	if _, err := store.SwapGUIDByUserID(ctx, "1", "g1"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if guid, err := store.GetGUIDByUsername(ctx, "alice"); err != nil || guid != "g1" {
+		t.Fatalf("GetGUIDByUsername after Swap = %q, %v, want g1", guid, err)
+	}
+
+	if _, err := store.SwapGUIDByUserID(ctx, "1", "g2"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if guid, err := store.GetGUIDByUsername(ctx, "alice"); err != nil || guid != "g2" {
+		t.Fatalf("GetGUIDByUsername after Swap = %q, %v, want g2", guid, err)
+	}
+
+	// Смена username сбрасывает кэш прежнего и нового username
+	if _, err := store.GetGUIDByUsername(ctx, "alice2"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername(alice2) error = %v, want ErrUsernameNotFound", err)
+	}
+	if previous, err := store.SetUsername(ctx, "1", "alice2"); err != nil || previous != "alice" {
+		t.Fatalf("SetUsername = %q, %v, want alice", previous, err)
+	}
+	guids, err := store.GetGUIDsByUsernames(ctx, []string{"alice", "alice2"})
+	if err != nil || len(guids) != 1 || guids["alice2"] != "g2" {
+		t.Fatalf("GetGUIDsByUsernames after rename = %v, %v, want only alice2 -> g2", guids, err)
+	}
+
+	if err := store.DeleteAvatarMapping(ctx, "1"); err != nil {
+		t.Fatalf("DeleteAvatarMapping: %v", err)
+	}
+	if _, err := store.GetGUIDByUsername(ctx, "alice2"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername after delete error = %v, want ErrUsernameNotFound", err)
+	}
+
+	// Удаление метаданных сбрасывает их кэш
+	if err := store.SetAvatarMetadata(ctx, &AvatarMetadata{GUID: "g2", UserID: "1"}); err != nil {
+		t.Fatalf("SetAvatarMetadata: %v", err)
+	}
+	if _, err := store.GetAvatarMetadata(ctx, "g2"); err != nil {
+		t.Fatalf("GetAvatarMetadata: %v", err)
+	}
+	if err := store.DeleteAvatarMetadata(ctx, "g2"); err != nil {
+		t.Fatalf("DeleteAvatarMetadata: %v", err)
+	}
+	if _, err := store.GetAvatarMetadata(ctx, "g2"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Fatalf("GetAvatarMetadata after delete error = %v, want ErrMetadataNotFound", err)
+	}
+}
@@ -0,0 +1,73 @@
+package clients
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrGravatarNotFound для email нет Gravatar
+var ErrGravatarNotFound = errors.New("gravatar not found for email")
+
+// gravatarSize запрашиваемый размер, совпадает с наибольшей копией аватарки
+const gravatarSize = 512
+
+// GravatarClient получает Gravatar по email. Базовый URL настраивается,
+// чтобы вместо gravatar.com можно было использовать заглушку
+type GravatarClient struct {
+	baseURL string
+	hash    string
+	fetcher *RemoteFetcher
+}
+
+// NewGravatarClient создает клиент. hash: "sha256" или "md5" (устаревший формат Gravatar)
+func NewGravatarClient(baseURL, hash string, fetcher *RemoteFetcher) (*GravatarClient, error) {
+	switch hash {
+	case "sha256", "md5":
+	default:
+		return nil, fmt.Errorf("unsupported gravatar hash %q: expected sha256 or md5", hash)
+	}
+
+	return &GravatarClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		hash:    hash,
+		fetcher: fetcher,
+	}, nil
+}
+
+// AvatarURL возвращает URL Gravatar для email. d=404 - без заглушки Gravatar,
+// чтобы отсутствие аватарки можно было отличить
+func (g *GravatarClient) AvatarURL(email string) string {
+	return fmt.Sprintf("%s/avatar/%s?s=%d&d=404", g.baseURL, g.emailHash(email), gravatarSize)
+}
+
+// DownloadAvatar скачивает Gravatar для email
+func (g *GravatarClient) DownloadAvatar(ctx context.Context, email string) (*RemoteFile, error) {
+	file, err := g.fetcher.Fetch(ctx, g.AvatarURL(email))
+	if err != nil {
+		var statusErr *RemoteStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil, ErrGravatarNotFound
+		}
+		return nil, err
+	}
+
+	file.Filename = "gravatar"
+	return file, nil
+}
+
+// emailHash хэш нормализованного email (без пробелов, в нижнем регистре)
+func (g *GravatarClient) emailHash(email string) string {
+	normalized := []byte(strings.ToLower(strings.TrimSpace(email)))
+	if g.hash == "md5" {
+		sum := md5.Sum(normalized)
+		return hex.EncodeToString(sum[:])
+	}
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:])
+}
@@ -10,6 +10,9 @@ import (
 type GRPCClient interface {
 	ValidateToken(ctx context.Context, token string) (*pb.UserResponse, error)
 	GetUserById(ctx context.Context, userId string) (*pb.UserResponse, error)
+	// CheckFriendship проверяет, что friendName в друзьях у userId.
+	// Если пользователи не друзья, возвращает ErrNotFriends
+	CheckFriendship(ctx context.Context, userId, friendName string) (*pb.FriendshipResponse, error)
 	Close() error
 }
 
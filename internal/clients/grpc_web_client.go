@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -190,45 +191,144 @@ func (c *GRPCWebClient) GetUserById(ctx context.Context, userId string) (*pb.Use
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("gRPC-Web request failed with status %d: %s", resp.StatusCode, string(body))
+	msgData, status, message, err := readGRPCWebResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case "", "0":
+	case grpcStatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userId)
+	default:
+		return nil, fmt.Errorf("gRPC-Web request failed with grpc-status %s: %s", status, message)
+	}
+	if msgData == nil {
+		return nil, fmt.Errorf("response too short")
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	userResp := &pb.UserResponse{}
+	if err := proto.Unmarshal(msgData, userResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return userResp, nil
+}
+
+var (
+	// ErrNotFriends возвращается CheckFriendship, если пользователи не друзья
+	ErrNotFriends = errors.New("users are not friends")
+	// ErrUserNotFound возвращается GetUserById, если пользователя с таким ID нет
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// grpcStatusNotFound код gRPC NOT_FOUND: UserService возвращает его, если
+// дружбы или пользователя нет
+const grpcStatusNotFound = "5"
+
+// CheckFriendship проверяет дружбу через gRPC-Web
+func (c *GRPCWebClient) CheckFriendship(ctx context.Context, userId, friendName string) (*pb.FriendshipResponse, error) {
+	req := &pb.FriendshipRequest{
+		UserId:     userId,
+		FriendName: friendName,
+	}
+
+	messageData, err := proto.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	var responseData []byte
-	if strings.Contains(contentType, "application/grpc-web-text") {
-		decoded, decodeErr := base64.StdEncoding.DecodeString(string(body))
-		if decodeErr != nil {
-			return nil, fmt.Errorf("failed to decode base64 response: %w", decodeErr)
-		}
-		responseData = decoded
-	} else {
-		responseData = body
+	var buf bytes.Buffer
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.BigEndian, uint32(len(messageData)))
+	buf.Write(messageData)
+
+	url := fmt.Sprintf("%s/user.UserService/CheckFriendship", c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	if len(responseData) < 5 {
+	httpReq.Header.Set("Content-Type", "application/grpc-web+proto")
+	httpReq.Header.Set("Accept", "application/grpc-web+proto")
+	httpReq.Header.Set("X-Grpc-Web", "1")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	msgData, status, message, err := readGRPCWebResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case "", "0":
+	case grpcStatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFriends, friendName)
+	default:
+		return nil, fmt.Errorf("gRPC-Web request failed with grpc-status %s: %s", status, message)
+	}
+	if msgData == nil {
 		return nil, fmt.Errorf("response too short")
 	}
 
-	responseMsgLen := binary.BigEndian.Uint32(responseData[1:5])
-	if len(responseData) < int(5+responseMsgLen) {
-		return nil, fmt.Errorf("response incomplete")
+	friendship := &pb.FriendshipResponse{}
+	if err := proto.Unmarshal(msgData, friendship); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if friendship.FriendId == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFriends, friendName)
 	}
 
-	msgData := responseData[5 : 5+responseMsgLen]
+	return friendship, nil
+}
 
-	userResp := &pb.UserResponse{}
-	if err := proto.Unmarshal(msgData, userResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+// readGRPCWebResponse читает ответ gRPC-Web и возвращает сообщение, grpc-status
+// и grpc-message. Ответ состоит из кадров [flags:1][length:4][data]: сообщение
+// (flags = 0) и трайлеры (flags = 0x80). При ошибке сервер может отдать статус
+// только в заголовках, без кадров
+func readGRPCWebResponse(resp *http.Response) ([]byte, string, string, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("gRPC-Web request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return userResp, nil
+	if strings.Contains(resp.Header.Get("Content-Type"), "application/grpc-web-text") {
+		body, err = base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to decode base64 response: %w", err)
+		}
+	}
+
+	status := resp.Header.Get("Grpc-Status")
+	message := resp.Header.Get("Grpc-Message")
+	var msgData []byte
+	for len(body) >= 5 {
+		frameLen := binary.BigEndian.Uint32(body[1:5])
+		if len(body) < int(5+frameLen) {
+			return nil, "", "", fmt.Errorf("response incomplete")
+		}
+		frame := body[5 : 5+frameLen]
+		if body[0]&0x80 == 0 {
+			msgData = frame
+		} else {
+			for _, line := range strings.Split(string(frame), "\r\n") {
+				key, value, _ := strings.Cut(line, ":")
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "grpc-status":
+					status = strings.TrimSpace(value)
+				case "grpc-message":
+					message = strings.TrimSpace(value)
+				}
+			}
+		}
+		body = body[5+frameLen:]
+	}
+	return msgData, status, message, nil
 }
 
 func (c *GRPCWebClient) Close() error {
@@ -0,0 +1,432 @@
+package clients
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LocalStorageRoute путь, по которому LocalStorage раздает файлы по подписанным ссылкам
+const LocalStorageRoute = "/storage/avatars/"
+
+// LocalStorage хранит аватарки на локальном диске (для разработки и single-node запусков).
+// Файлы раздаются через LocalStorageRoute по ссылкам, подписанным HMAC
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+	// multipartDir каталог незавершенных составных загрузок: <uploadID>/<номер части>
+	multipartDir string
+}
+
+// localObjectMeta метаданные объекта, хранящиеся рядом с файлом
+type localObjectMeta struct {
+	ContentType string `json:"content_type"`
+}
+
+// localMultipartMeta сведения о составной загрузке, хранящиеся рядом с частями
+type localMultipartMeta struct {
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+}
+
+func NewLocalStorage(dir, baseURL, secret string) (*LocalStorage, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("local storage secret is required")
+	}
+
+	avatarsDir := filepath.Join(dir, "avatars")
+	if err := os.MkdirAll(avatarsDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage dir: %w", err)
+	}
+	multipartDir := filepath.Join(dir, "multipart")
+	if err := os.MkdirAll(multipartDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage dir: %w", err)
+	}
+
+	return &LocalStorage{
+		dir:          avatarsDir,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		secret:       []byte(secret),
+		multipartDir: multipartDir,
+	}, nil
+}
+
+// UploadAvatar сохраняет аватарку на диск
+func (l *LocalStorage) UploadAvatar(ctx context.Context, id string, file io.Reader, contentType string, size int64) error {
+	if err := validateObjectID(id); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы читатели не увидели частичную запись
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write avatar: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("avatar size mismatch: expected %d bytes, got %d", size, written)
+	}
+
+	meta, err := json.Marshal(localObjectMeta{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to marshal object metadata: %w", err)
+	}
+	if err := os.WriteFile(l.metaPath(id), meta, 0o644); err != nil {
+		return fmt.Errorf("failed to write object metadata: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), l.filePath(id)); err != nil {
+		return fmt.Errorf("failed to store avatar: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAvatar удаляет аватарку с диска
+func (l *LocalStorage) DeleteAvatar(ctx context.Context, id string) error {
+	if err := validateObjectID(id); err != nil {
+		return err
+	}
+
+	if err := os.Remove(l.filePath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	if err := os.Remove(l.metaPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete object metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetAvatarPresignedURL возвращает подписанную ссылку на LocalStorageRoute
+func (l *LocalStorage) GetAvatarPresignedURL(ctx context.Context, id string, signedAt time.Time, expiresIn int64) (string, error) {
+	if err := validateObjectID(id); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(signedAt.Unix()+expiresIn, 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.sign(id, expires))
+
+	return fmt.Sprintf("%s%s%s?%s", l.baseURL, LocalStorageRoute, url.PathEscape(id), query.Encode()), nil
+}
+
+// HeadAvatar получает сведения о файле аватарки
+func (l *LocalStorage) HeadAvatar(ctx context.Context, id string) (*ObjectInfo, error) {
+	if err := validateObjectID(id); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(l.filePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat avatar: %w", err)
+	}
+
+	return &ObjectInfo{
+		Key:          avatarKey(id),
+		Size:         stat.Size(),
+		ContentType:  l.contentType(id),
+		ETag:         fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// OpenAvatar открывает файл аватарки для чтения
+func (l *LocalStorage) OpenAvatar(ctx context.Context, id string) (io.ReadCloser, error) {
+	if err := validateObjectID(id); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(l.filePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open avatar: %w", err)
+	}
+	return file, nil
+}
+
+// OpenAvatarRange открывает файл аватарки для чтения с offset
+func (l *LocalStorage) OpenAvatarRange(ctx context.Context, id string, offset int64) (io.ReadCloser, error) {
+	if err := validateObjectID(id); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(l.filePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open avatar: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek avatar: %w", err)
+	}
+	return file, nil
+}
+
+// GetUploadPresignedURL возвращает подписанную ссылку для PUT на LocalStorageRoute.
+// Content-Type и размер входят в подпись
+func (l *LocalStorage) GetUploadPresignedURL(ctx context.Context, id, contentType string, size int64, expiresIn int64) (string, error) {
+	if err := validateObjectID(id); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Unix()+expiresIn, 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.signUpload(id, expires, contentType, size))
+
+	return fmt.Sprintf("%s%s%s?%s", l.baseURL, LocalStorageRoute, url.PathEscape(id), query.Encode()), nil
+}
+
+// ServeHTTP раздает файлы по подписанным ссылкам из GetAvatarPresignedURL
+// и принимает PUT по ссылкам из GetUploadPresignedURL
+func (l *LocalStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, LocalStorageRoute)
+	if validateObjectID(id) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		l.servePut(w, r, id)
+		return
+	}
+
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+	if !hmac.Equal([]byte(signature), []byte(l.sign(id, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+
+	file, err := os.Open(l.filePath(id))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		http.Error(w, "failed to read avatar", http.StatusInternalServerError)
+		return
+	}
+
+	if contentType := l.contentType(id); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", ImmutableCacheControl)
+	http.ServeContent(w, r, id, stat.ModTime(), file)
+}
+
+// servePut сохраняет файл, если Content-Type и Content-Length совпадают с подписанными
+func (l *LocalStorage) servePut(w http.ResponseWriter, r *http.Request, id string) {
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+	contentType := r.Header.Get("Content-Type")
+	if !hmac.Equal([]byte(signature), []byte(l.signUpload(id, expires, contentType, r.ContentLength))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, r.ContentLength)
+	if err := l.UploadAvatar(r.Context(), id, body, contentType, r.ContentLength); err != nil {
+		http.Error(w, "failed to store object", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// CreateMultipartUpload начинает составную загрузку: части складываются в отдельный каталог
+func (l *LocalStorage) CreateMultipartUpload(ctx context.Context, id, contentType string) (string, error) {
+	if err := validateObjectID(id); err != nil {
+		return "", err
+	}
+
+	uploadID := uuid.New().String()
+	dir := filepath.Join(l.multipartDir, uploadID)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create multipart upload dir: %w", err)
+	}
+
+	meta, err := json.Marshal(localMultipartMeta{ID: id, ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal multipart metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), meta, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write multipart metadata: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart сохраняет часть составной загрузки на диск и возвращает ее ETag (md5)
+func (l *LocalStorage) UploadPart(ctx context.Context, id, uploadID string, partNumber int32, data io.Reader, size int64) (string, error) {
+	dir, err := l.multipartUploadDir(id, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".part-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write part: %w", err)
+	}
+	if written != size {
+		return "", fmt.Errorf("part size mismatch: expected %d bytes, got %d", size, written)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(int(partNumber)))); err != nil {
+		return "", fmt.Errorf("failed to store part: %w", err)
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+// CompleteMultipartUpload склеивает части в порядке parts и сохраняет объект
+func (l *LocalStorage) CompleteMultipartUpload(ctx context.Context, id, uploadID string, parts []UploadedPart) error {
+	dir, err := l.multipartUploadDir(id, uploadID)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read multipart metadata: %w", err)
+	}
+	var meta localMultipartMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("failed to unmarshal multipart metadata: %w", err)
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(int(part.Number))))
+		if err != nil {
+			return fmt.Errorf("failed to open part %d: %w", part.Number, err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	if err := l.UploadAvatar(ctx, id, io.MultiReader(readers...), meta.ContentType, -1); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipartUpload удаляет каталог с частями составной загрузки
+func (l *LocalStorage) AbortMultipartUpload(ctx context.Context, id, uploadID string) error {
+	if err := validateObjectID(uploadID); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(l.multipartDir, uploadID)); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// multipartUploadDir возвращает каталог составной загрузки, проверяя, что она существует
+func (l *LocalStorage) multipartUploadDir(id, uploadID string) (string, error) {
+	if err := validateObjectID(id); err != nil {
+		return "", err
+	}
+	if err := validateObjectID(uploadID); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(l.multipartDir, uploadID)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("multipart upload not found: %s", uploadID)
+	}
+	return dir, nil
+}
+
+func (l *LocalStorage) sign(id, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(id + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *LocalStorage) signUpload(id, expires, contentType string, size int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte("PUT\n" + id + "\n" + expires + "\n" + contentType + "\n" + strconv.FormatInt(size, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *LocalStorage) contentType(id string) string {
+	data, err := os.ReadFile(l.metaPath(id))
+	if err != nil {
+		return ""
+	}
+	var meta localObjectMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return ""
+	}
+	return meta.ContentType
+}
+
+func (l *LocalStorage) filePath(id string) string {
+	return filepath.Join(l.dir, id)
+}
+
+func (l *LocalStorage) metaPath(id string) string {
+	return filepath.Join(l.dir, id+".meta.json")
+}
@@ -0,0 +1,374 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryMetadataStore потокобезопасное хранилище метаданных в памяти
+// (для тестов и single-node запусков)
+type MemoryMetadataStore struct {
+	mu sync.RWMutex
+	// current ID пользователя -> GUID текущей аватарки
+	current map[string]string
+	// usernames username -> ID пользователя, userIDs - обратный индекс
+	usernames map[string]string
+	userIDs   map[string]string
+	avatars   map[string]AvatarMetadata
+	uploads   map[string]PendingUpload
+	refs      map[string]int64
+	deleting  map[string]time.Time
+	history   map[string][]string
+	deleted   map[string]DeletedAvatar
+}
+
+func NewMemoryMetadataStore() *MemoryMetadataStore {
+	return &MemoryMetadataStore{
+		current:   make(map[string]string),
+		usernames: make(map[string]string),
+		userIDs:   make(map[string]string),
+		avatars:   make(map[string]AvatarMetadata),
+		uploads:   make(map[string]PendingUpload),
+		refs:      make(map[string]int64),
+		deleting:  make(map[string]time.Time),
+		history:   make(map[string][]string),
+		deleted:   make(map[string]DeletedAvatar),
+	}
+}
+
+// GetGUIDByUserID получает GUID текущей аватарки пользователя
+func (m *MemoryMetadataStore) GetGUIDByUserID(ctx context.Context, userID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	guid, ok := m.current[userID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, userID)
+	}
+	return guid, nil
+}
+
+// SwapGUIDByUserID заменяет текущую аватарку пользователя и возвращает предыдущий GUID
+func (m *MemoryMetadataStore) SwapGUIDByUserID(ctx context.Context, userID, guid string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldGUID := m.current[userID]
+	m.current[userID] = guid
+	return oldGUID, nil
+}
+
+// DeleteAvatarMapping удаляет связь пользователя с текущей аватаркой
+func (m *MemoryMetadataStore) DeleteAvatarMapping(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.current, userID)
+	return nil
+}
+
+// GetGUIDByUsername получает GUID текущей аватарки владельца username
+func (m *MemoryMetadataStore) GetGUIDByUsername(ctx context.Context, username string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	guid, ok := m.current[m.usernames[username]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, username)
+	}
+	return guid, nil
+}
+
+// GetGUIDsByUsernames получает GUIDs для списка username
+func (m *MemoryMetadataStore) GetGUIDsByUsernames(ctx context.Context, usernames []string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]string)
+	for _, username := range usernames {
+		if guid, ok := m.current[m.usernames[username]]; ok {
+			result[username] = guid
+		}
+	}
+	return result, nil
+}
+
+// SetUsername делает username псевдонимом пользователя userID
+func (m *MemoryMetadataStore) SetUsername(ctx context.Context, userID, username string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.userIDs[userID]
+	if previous != "" && m.usernames[previous] == userID {
+		delete(m.usernames, previous)
+	}
+	if owner, ok := m.usernames[username]; ok && owner != userID {
+		delete(m.userIDs, owner)
+	}
+	m.usernames[username] = userID
+	m.userIDs[userID] = username
+	return previous, nil
+}
+
+// GetUsernameByUserID получает username по ID пользователя
+func (m *MemoryMetadataStore) GetUsernameByUserID(ctx context.Context, userID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	username, ok := m.userIDs[userID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUserIDNotFound, userID)
+	}
+	return username, nil
+}
+
+// GetUsernamesByUserIDs получает username для списка ID пользователей
+func (m *MemoryMetadataStore) GetUsernamesByUserIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]string)
+	for _, userID := range userIDs {
+		if username, ok := m.userIDs[userID]; ok {
+			result[userID] = username
+		}
+	}
+	return result, nil
+}
+
+// GetAvatarMetadata получает метаданные аватарки по GUID
+func (m *MemoryMetadataStore) GetAvatarMetadata(ctx context.Context, guid string) (*AvatarMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	metadata, ok := m.avatars[guid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMetadataNotFound, guid)
+	}
+	return &metadata, nil
+}
+
+// GetAvatarsMetadata получает метаданные для списка GUID
+func (m *MemoryMetadataStore) GetAvatarsMetadata(ctx context.Context, guids []string) (map[string]*AvatarMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]*AvatarMetadata)
+	for _, guid := range guids {
+		if metadata, ok := m.avatars[guid]; ok {
+			result[guid] = &metadata
+		}
+	}
+	return result, nil
+}
+
+// SetAvatarMetadata устанавливает метаданные аватарки
+func (m *MemoryMetadataStore) SetAvatarMetadata(ctx context.Context, metadata *AvatarMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.avatars[metadata.GUID] = *metadata
+	return nil
+}
+
+// DeleteAvatarMetadata удаляет метаданные аватарки
+func (m *MemoryMetadataStore) DeleteAvatarMetadata(ctx context.Context, guid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.avatars, guid)
+	return nil
+}
+
+// AcquireObject увеличивает счетчик ссылок на объект
+func (m *MemoryMetadataStore) AcquireObject(ctx context.Context, objectID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if until, ok := m.deleting[objectID]; ok {
+		if time.Now().Before(until) {
+			return 0, fmt.Errorf("%w: %s", ErrObjectDeleting, objectID)
+		}
+		delete(m.deleting, objectID)
+	}
+
+	m.refs[objectID]++
+	return m.refs[objectID], nil
+}
+
+// ReleaseObject уменьшает счетчик ссылок на объект
+func (m *MemoryMetadataStore) ReleaseObject(ctx context.Context, objectID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refs := m.refs[objectID] - 1
+	if refs <= 0 {
+		delete(m.refs, objectID)
+		m.deleting[objectID] = time.Now().Add(ObjectDeletionLease)
+	} else {
+		m.refs[objectID] = refs
+	}
+	return refs, nil
+}
+
+// FinishObjectDeletion снимает метку удаления объекта
+func (m *MemoryMetadataStore) FinishObjectDeletion(ctx context.Context, objectID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.deleting, objectID)
+	return nil
+}
+
+// PushAvatarHistory добавляет GUID в начало истории пользователя
+func (m *MemoryMetadataStore) PushAvatarHistory(ctx context.Context, userID, guid string, depth int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history := slices.DeleteFunc(slices.Clone(m.history[userID]), func(id string) bool { return id == guid })
+	history = slices.Insert(history, 0, guid)
+
+	var evicted []string
+	if len(history) > depth {
+		evicted = slices.Clone(history[depth:])
+		history = history[:depth]
+	}
+	m.history[userID] = history
+	return evicted, nil
+}
+
+// GetAvatarHistory возвращает историю пользователя, начиная с последней аватарки
+func (m *MemoryMetadataStore) GetAvatarHistory(ctx context.Context, userID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.history[userID]), nil
+}
+
+// RemoveAvatarHistory удаляет GUID из истории пользователя
+func (m *MemoryMetadataStore) RemoveAvatarHistory(ctx context.Context, userID, guid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history := slices.DeleteFunc(slices.Clone(m.history[userID]), func(id string) bool { return id == guid })
+	if len(history) == 0 {
+		delete(m.history, userID)
+	} else {
+		m.history[userID] = history
+	}
+	return nil
+}
+
+// GetDeletedAvatar получает удаленную аватарку пользователя
+func (m *MemoryMetadataStore) GetDeletedAvatar(ctx context.Context, userID string) (*DeletedAvatar, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deleted, ok := m.deleted[userID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDeletedAvatarNotFound, userID)
+	}
+	return &deleted, nil
+}
+
+// SetDeletedAvatar сохраняет удаленную аватарку
+func (m *MemoryMetadataStore) SetDeletedAvatar(ctx context.Context, deleted *DeletedAvatar) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleted[deleted.UserID] = *deleted
+	return nil
+}
+
+// DeleteDeletedAvatar удаляет запись об удаленной аватарке пользователя
+func (m *MemoryMetadataStore) DeleteDeletedAvatar(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.deleted, userID)
+	return nil
+}
+
+// ListExpiredDeletions возвращает удаленные аватарки с истекшим сроком, начиная с самых старых
+func (m *MemoryMetadataStore) ListExpiredDeletions(ctx context.Context, before time.Time, limit int) ([]*DeletedAvatar, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deletions []*DeletedAvatar
+	for _, deleted := range m.deleted {
+		if deleted.PurgeAt.Before(before) {
+			deletions = append(deletions, &deleted)
+		}
+	}
+
+	sort.Slice(deletions, func(i, j int) bool {
+		return deletions[i].PurgeAt.Before(deletions[j].PurgeAt)
+	})
+	if len(deletions) > limit {
+		deletions = deletions[:limit]
+	}
+	return deletions, nil
+}
+
+// GetPendingUpload получает незавершенную загрузку по ID
+func (m *MemoryMetadataStore) GetPendingUpload(ctx context.Context, id string) (*PendingUpload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	upload, ok := m.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, id)
+	}
+	upload.Parts = slices.Clone(upload.Parts)
+	return &upload, nil
+}
+
+// SetPendingUpload сохраняет незавершенную загрузку
+func (m *MemoryMetadataStore) SetPendingUpload(ctx context.Context, upload *PendingUpload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *upload
+	stored.Parts = slices.Clone(upload.Parts)
+	m.uploads[upload.ID] = stored
+	return nil
+}
+
+// DeletePendingUpload удаляет незавершенную загрузку
+func (m *MemoryMetadataStore) DeletePendingUpload(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.uploads, id)
+	return nil
+}
+
+// ListExpiredUploads возвращает загрузки, истекшие до before, начиная с самых старых
+func (m *MemoryMetadataStore) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*PendingUpload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var uploads []*PendingUpload
+	for _, upload := range m.uploads {
+		if upload.ExpiresAt.Before(before) {
+			upload.Parts = slices.Clone(upload.Parts)
+			uploads = append(uploads, &upload)
+		}
+	}
+
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].ExpiresAt.Before(uploads[j].ExpiresAt)
+	})
+	if len(uploads) > limit {
+		uploads = uploads[:limit]
+	}
+	return uploads, nil
+}
+
+func (m *MemoryMetadataStore) Close() error {
+	return nil
+}
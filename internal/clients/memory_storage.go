@@ -0,0 +1,212 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStorage хранит аватарки в памяти процесса (для тестов)
+type MemoryStorage struct {
+	mu         sync.RWMutex
+	objects    map[string]memoryObject
+	multiparts map[string]*memoryMultipart
+}
+
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// memoryMultipart незавершенная составная загрузка
+type memoryMultipart struct {
+	id          string
+	contentType string
+	parts       map[int32][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects:    make(map[string]memoryObject),
+		multiparts: make(map[string]*memoryMultipart),
+	}
+}
+
+// UploadAvatar сохраняет аватарку в памяти
+func (m *MemoryStorage) UploadAvatar(ctx context.Context, id string, file io.Reader, contentType string, size int64) error {
+	if err := validateObjectID(id); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("avatar size mismatch: expected %d bytes, got %d", size, len(data))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[id] = memoryObject{
+		data:         data,
+		contentType:  contentType,
+		lastModified: time.Now(),
+	}
+
+	return nil
+}
+
+// DeleteAvatar удаляет аватарку из памяти
+func (m *MemoryStorage) DeleteAvatar(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, id)
+	return nil
+}
+
+// GetAvatarPresignedURL возвращает условную ссылку memory://avatars/<id>
+func (m *MemoryStorage) GetAvatarPresignedURL(ctx context.Context, id string, signedAt time.Time, expiresIn int64) (string, error) {
+	return fmt.Sprintf("memory://%s?expires=%d", avatarKey(id), signedAt.Unix()+expiresIn), nil
+}
+
+// HeadAvatar получает сведения об объекте в памяти
+func (m *MemoryStorage) HeadAvatar(ctx context.Context, id string) (*ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[id]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	sum := md5.Sum(obj.data)
+	return &ObjectInfo{
+		Key:          avatarKey(id),
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: obj.lastModified,
+	}, nil
+}
+
+// OpenAvatar возвращает содержимое объекта из памяти
+func (m *MemoryStorage) OpenAvatar(ctx context.Context, id string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[id]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// OpenAvatarRange возвращает содержимое объекта из памяти начиная с offset
+func (m *MemoryStorage) OpenAvatarRange(ctx context.Context, id string, offset int64) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[id]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	if offset < 0 || offset > int64(len(obj.data)) {
+		return nil, fmt.Errorf("invalid offset %d for object of %d bytes", offset, len(obj.data))
+	}
+	return io.NopCloser(bytes.NewReader(obj.data[offset:])), nil
+}
+
+// GetUploadPresignedURL возвращает условную ссылку для загрузки; загрузка по ней
+// невозможна, объект кладется в память через UploadAvatar
+func (m *MemoryStorage) GetUploadPresignedURL(ctx context.Context, id, contentType string, size int64, expiresIn int64) (string, error) {
+	return fmt.Sprintf("memory://%s?method=PUT&expires=%d", avatarKey(id), time.Now().Unix()+expiresIn), nil
+}
+
+// CreateMultipartUpload начинает составную загрузку в памяти
+func (m *MemoryStorage) CreateMultipartUpload(ctx context.Context, id, contentType string) (string, error) {
+	if err := validateObjectID(id); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uploadID := uuid.New().String()
+	m.multiparts[uploadID] = &memoryMultipart{
+		id:          id,
+		contentType: contentType,
+		parts:       make(map[int32][]byte),
+	}
+	return uploadID, nil
+}
+
+// UploadPart сохраняет часть составной загрузки в памяти
+func (m *MemoryStorage) UploadPart(ctx context.Context, id, uploadID string, partNumber int32, data io.Reader, size int64) (string, error) {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to read part: %w", err)
+	}
+	if int64(len(content)) != size {
+		return "", fmt.Errorf("part size mismatch: expected %d bytes, got %d", size, len(content))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.multiparts[uploadID]
+	if !ok || upload.id != id {
+		return "", fmt.Errorf("multipart upload not found: %s", uploadID)
+	}
+	upload.parts[partNumber] = content
+
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// CompleteMultipartUpload собирает объект из частей в порядке parts
+func (m *MemoryStorage) CompleteMultipartUpload(ctx context.Context, id, uploadID string, parts []UploadedPart) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.multiparts[uploadID]
+	if !ok || upload.id != id {
+		return fmt.Errorf("multipart upload not found: %s", uploadID)
+	}
+
+	var data []byte
+	for _, part := range parts {
+		content, ok := upload.parts[part.Number]
+		if !ok {
+			return fmt.Errorf("part %d was not uploaded", part.Number)
+		}
+		data = append(data, content...)
+	}
+
+	m.objects[id] = memoryObject{
+		data:         data,
+		contentType:  upload.contentType,
+		lastModified: time.Now(),
+	}
+	delete(m.multiparts, uploadID)
+	return nil
+}
+
+// AbortMultipartUpload удаляет незавершенную составную загрузку
+func (m *MemoryStorage) AbortMultipartUpload(ctx context.Context, id, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.multiparts, uploadID)
+	return nil
+}
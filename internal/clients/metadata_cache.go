@@ -0,0 +1,192 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// metadataCachePrefix отделяет ключи кэша от данных RedisClient в том же Redis
+	metadataCachePrefix = "metacache:"
+	// metadataCacheMiss значение, которым кэшируется отсутствие записи
+	metadataCacheMiss = "-"
+)
+
+// MetadataCache кэш метаданных в Redis для CachedMetadataStore. Все ключи живут
+// под префиксом metacache: с TTL, поэтому запись, которую не удалось обновить
+// или удалить, устаревает сама. Отсутствие записи кэшируется на negativeTTL,
+// чтобы запросы несуществующих username не доходили до основного хранилища
+type MetadataCache struct {
+	client      *redis.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+func NewMetadataCache(redisURL string, ttl, negativeTTL time.Duration) (*MetadataCache, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &MetadataCache{
+		client:      client,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}, nil
+}
+
+func usernameCacheKey(username string) string {
+	return metadataCachePrefix + "username:" + username
+}
+
+func avatarCacheKey(guid string) string {
+	return metadataCachePrefix + "avatar:" + guid
+}
+
+// GUIDs возвращает закэшированные GUID текущих аватарок для usernames.
+// Пустая строка - закэшированное отсутствие аватарки; промахи в результат не попадают
+func (c *MetadataCache) GUIDs(ctx context.Context, usernames []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(usernames) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = usernameCacheKey(username)
+	}
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached guids: %w", err)
+	}
+
+	for i, value := range values {
+		guid, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if guid == metadataCacheMiss {
+			guid = ""
+		}
+		result[usernames[i]] = guid
+	}
+	return result, nil
+}
+
+// SetGUIDs кэширует GUID для username; пустая строка кэширует отсутствие аватарки
+func (c *MetadataCache) SetGUIDs(ctx context.Context, guids map[string]string) error {
+	if len(guids) == 0 {
+		return nil
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for username, guid := range guids {
+			if guid == "" {
+				pipe.Set(ctx, usernameCacheKey(username), metadataCacheMiss, c.negativeTTL)
+			} else {
+				pipe.Set(ctx, usernameCacheKey(username), guid, c.ttl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cache guids: %w", err)
+	}
+	return nil
+}
+
+// DeleteUsernames удаляет закэшированные GUID для usernames
+func (c *MetadataCache) DeleteUsernames(ctx context.Context, usernames ...string) error {
+	keys := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		if username != "" {
+			keys = append(keys, usernameCacheKey(username))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.client.Del(ctx, keys...).Err()
+}
+
+// Metadata возвращает закэшированные метаданные для guids.
+// nil - закэшированное отсутствие метаданных; промахи в результат не попадают
+func (c *MetadataCache) Metadata(ctx context.Context, guids []string) (map[string]*AvatarMetadata, error) {
+	result := make(map[string]*AvatarMetadata)
+	if len(guids) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(guids))
+	for i, guid := range guids {
+		keys[i] = avatarCacheKey(guid)
+	}
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached metadata: %w", err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if data == metadataCacheMiss {
+			result[guids[i]] = nil
+			continue
+		}
+		var metadata AvatarMetadata
+		if err := json.Unmarshal([]byte(data), &metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cached metadata: %w", err)
+		}
+		result[guids[i]] = &metadata
+	}
+	return result, nil
+}
+
+// SetMetadata кэширует метаданные по GUID; nil кэширует отсутствие метаданных
+func (c *MetadataCache) SetMetadata(ctx context.Context, metadata map[string]*AvatarMetadata) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for guid, m := range metadata {
+			if m == nil {
+				pipe.Set(ctx, avatarCacheKey(guid), metadataCacheMiss, c.negativeTTL)
+				continue
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				return fmt.Errorf("failed to marshal metadata: %w", err)
+			}
+			pipe.Set(ctx, avatarCacheKey(guid), data, c.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cache metadata: %w", err)
+	}
+	return nil
+}
+
+// DeleteMetadata удаляет закэшированные метаданные
+func (c *MetadataCache) DeleteMetadata(ctx context.Context, guid string) error {
+	return c.client.Del(ctx, avatarCacheKey(guid)).Err()
+}
+
+func (c *MetadataCache) Close() error {
+	return c.client.Close()
+}
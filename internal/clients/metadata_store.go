@@ -0,0 +1,128 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+)
+
+var (
+	// ErrUsernameNotFound возвращается, если у пользователя (по username или ID) нет аватарки
+	ErrUsernameNotFound = errors.New("username not found")
+	// ErrMetadataNotFound возвращается, если метаданные аватарки отсутствуют
+	ErrMetadataNotFound = errors.New("avatar metadata not found")
+	// ErrUploadNotFound возвращается, если незавершенная загрузка не найдена
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrDeletedAvatarNotFound возвращается, если у пользователя нет удаленной аватарки
+	ErrDeletedAvatarNotFound = errors.New("deleted avatar not found")
+	// ErrUserIDNotFound возвращается, если у ID пользователя нет username
+	ErrUserIDNotFound = errors.New("user id not found")
+	// ErrObjectDeleting возвращается AcquireObject, пока файлы объекта удаляются
+	ErrObjectDeleting = errors.New("avatar object is being deleted")
+)
+
+// ObjectDeletionLease сколько действует метка удаления объекта, если удаливший
+// его экземпляр не снял ее через FinishObjectDeletion (например, упал)
+const ObjectDeletionLease = time.Minute
+
+// MetadataStore интерфейс хранилища метаданных аватарок (Redis или память)
+type MetadataStore interface {
+	// Текущая аватарка, история и удаленная аватарка принадлежат ID пользователя.
+	// SwapGUIDByUserID атомарно заменяет текущую аватарку и возвращает предыдущий GUID
+	GetGUIDByUserID(ctx context.Context, userID string) (string, error)
+	SwapGUIDByUserID(ctx context.Context, userID, guid string) (string, error)
+	DeleteAvatarMapping(ctx context.Context, userID string) error
+	// GetGUIDByUsername возвращает текущую аватарку пользователя, которому принадлежит username
+	GetGUIDByUsername(ctx context.Context, username string) (string, error)
+	// GetGUIDsByUsernames возвращает GUID для найденных username, остальные пропускаются
+	GetGUIDsByUsernames(ctx context.Context, usernames []string) (map[string]string, error)
+
+	// SetUsername одной операцией делает username псевдонимом пользователя userID
+	// и возвращает его прежний username. Прежний username освобождается; если новый
+	// принадлежал другому пользователю, тот его теряет
+	SetUsername(ctx context.Context, userID, username string) (string, error)
+	GetUsernameByUserID(ctx context.Context, userID string) (string, error)
+	// GetUsernamesByUserIDs возвращает username для найденных ID, остальные пропускаются
+	GetUsernamesByUserIDs(ctx context.Context, userIDs []string) (map[string]string, error)
+
+	GetAvatarMetadata(ctx context.Context, guid string) (*AvatarMetadata, error)
+	GetAvatarsMetadata(ctx context.Context, guids []string) (map[string]*AvatarMetadata, error)
+	SetAvatarMetadata(ctx context.Context, metadata *AvatarMetadata) error
+	DeleteAvatarMetadata(ctx context.Context, guid string) error
+
+	// AcquireObject увеличивает счетчик ссылок на объект хранилища и возвращает новое значение.
+	// Пока на объекте стоит метка удаления, возвращает ErrObjectDeleting
+	AcquireObject(ctx context.Context, objectID string) (int64, error)
+	// ReleaseObject уменьшает счетчик ссылок на объект и возвращает оставшееся
+	// количество ссылок. При нуле счетчик удаляется и на объект ставится метка
+	// удаления на ObjectDeletionLease: вызывающий удаляет файлы и снимает ее
+	ReleaseObject(ctx context.Context, objectID string) (int64, error)
+	// FinishObjectDeletion снимает метку удаления после удаления файлов объекта
+	FinishObjectDeletion(ctx context.Context, objectID string) error
+
+	// PushAvatarHistory добавляет GUID в начало истории пользователя, оставляя не больше
+	// depth записей, и возвращает GUID, не поместившиеся в историю
+	PushAvatarHistory(ctx context.Context, userID, guid string, depth int) ([]string, error)
+	// GetAvatarHistory возвращает GUID предыдущих аватарок пользователя, начиная с последней
+	GetAvatarHistory(ctx context.Context, userID string) ([]string, error)
+	RemoveAvatarHistory(ctx context.Context, userID, guid string) error
+
+	GetDeletedAvatar(ctx context.Context, userID string) (*DeletedAvatar, error)
+	SetDeletedAvatar(ctx context.Context, deleted *DeletedAvatar) error
+	DeleteDeletedAvatar(ctx context.Context, userID string) error
+	// ListExpiredDeletions возвращает до limit удаленных аватарок, срок восстановления которых истек до before
+	ListExpiredDeletions(ctx context.Context, before time.Time, limit int) ([]*DeletedAvatar, error)
+
+	GetPendingUpload(ctx context.Context, id string) (*PendingUpload, error)
+	SetPendingUpload(ctx context.Context, upload *PendingUpload) error
+	DeletePendingUpload(ctx context.Context, id string) error
+	// ListExpiredUploads возвращает до limit загрузок, истекших до before
+	ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*PendingUpload, error)
+
+	Close() error
+}
+
+// DeletedAvatar удаленная пользователем аватарка, которую еще можно восстановить.
+// Файлы и метаданные хранятся до PurgeAt
+type DeletedAvatar struct {
+	UserID    string    `json:"user_id"`
+	GUID      string    `json:"guid"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// Виды незавершенных загрузок (PendingUpload.Kind)
+const (
+	// UploadKindDirect загрузка по presigned ссылке одним PUT
+	UploadKindDirect = "direct"
+	// UploadKindResumable возобновляемая загрузка по tus поверх multipart
+	UploadKindResumable = "tus"
+)
+
+// PendingUpload незавершенная загрузка файла клиентом напрямую в хранилище
+// или возобновляемая загрузка по частям
+type PendingUpload struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind,omitempty"`
+	UserID      string    `json:"user_id,omitempty"`
+	Username    string    `json:"username"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	// Поля возобновляемой загрузки
+	Filename string `json:"filename,omitempty"`
+	// Offset сколько байт получено от клиента
+	Offset int64 `json:"offset,omitempty"`
+	// MultipartID идентификатор составной загрузки в хранилище
+	MultipartID string `json:"multipart_id,omitempty"`
+	// Parts уже загруженные в хранилище части
+	Parts []UploadedPart `json:"parts,omitempty"`
+	// Metadata заголовок Upload-Metadata, переданный при создании
+	Metadata string `json:"metadata,omitempty"`
+	// Crop параметры обрезки, применяемые по завершении загрузки
+	Crop *imaging.Crop `json:"crop,omitempty"`
+}
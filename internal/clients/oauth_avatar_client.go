@@ -0,0 +1,55 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrUnknownOAuthProvider провайдер не настроен в OAUTH_AVATAR_PROVIDERS
+var ErrUnknownOAuthProvider = errors.New("unknown OAuth provider")
+
+// OAuthAvatarClient скачивает аватарки OAuth провайдеров (picture из профиля Google,
+// avatar_url GitHub и т.п.). URL должен находиться под базовым URL провайдера
+type OAuthAvatarClient struct {
+	providers map[string]*url.URL
+	fetcher   *RemoteFetcher
+}
+
+// NewOAuthAvatarClient создает клиент. providers: имя провайдера -> базовый URL картинок
+func NewOAuthAvatarClient(providers map[string]string, fetcher *RemoteFetcher) (*OAuthAvatarClient, error) {
+	parsed := make(map[string]*url.URL, len(providers))
+	for name, baseURL := range providers {
+		base, err := url.Parse(baseURL)
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid base URL for OAuth provider %s: %q", name, baseURL)
+		}
+		parsed[strings.ToLower(name)] = base
+	}
+
+	return &OAuthAvatarClient{
+		providers: parsed,
+		fetcher:   fetcher,
+	}, nil
+}
+
+// DownloadAvatar скачивает картинку профиля провайдера
+func (c *OAuthAvatarClient) DownloadAvatar(ctx context.Context, provider, pictureURL string) (*RemoteFile, error) {
+	base, ok := c.providers[strings.ToLower(provider)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOAuthProvider, provider)
+	}
+
+	picture, err := url.Parse(pictureURL)
+	if err != nil {
+		return nil, forbidden("invalid URL")
+	}
+	if !strings.EqualFold(picture.Scheme, base.Scheme) || !strings.EqualFold(picture.Host, base.Host) ||
+		!strings.HasPrefix(picture.Path, base.Path) {
+		return nil, forbidden("picture URL does not belong to provider %s", provider)
+	}
+
+	return c.fetcher.Fetch(ctx, picture.String())
+}
@@ -0,0 +1,86 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ObjectReader читает объект хранилища как io.ReadSeeker, не загружая его целиком.
+// Seek только запоминает позицию, объект открывается с нужного смещения при
+// первом Read. Поэтому http.ServeContent отдает запросы Range, читая из
+// хранилища только запрошенную часть, а HEAD и 304 не читают объект вовсе
+type ObjectReader struct {
+	ctx     context.Context
+	storage BlobStorage
+	id      string
+	size    int64
+
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewObjectReader создает ObjectReader для объекта id размером size байт
+func NewObjectReader(ctx context.Context, storage BlobStorage, id string, size int64) *ObjectReader {
+	return &ObjectReader{
+		ctx:     ctx,
+		storage: storage,
+		id:      id,
+		size:    size,
+	}
+}
+
+// Read читает объект с текущей позиции
+func (o *ObjectReader) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		body, err := o.storage.OpenAvatarRange(o.ctx, o.id, o.offset)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek меняет позицию чтения. Открытый объект закрывается, если позиция изменилась
+func (o *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != o.offset {
+		o.closeBody()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+// Close закрывает открытый объект
+func (o *ObjectReader) Close() error {
+	return o.closeBody()
+}
+
+func (o *ObjectReader) closeBody() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
@@ -2,14 +2,19 @@ package clients
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 type R2Client struct {
@@ -47,9 +52,10 @@ func NewR2Client(accountID, accessKeyID, secretKey, bucketName, endpoint string)
 	}, nil
 }
 
-// UploadAvatar загружает аватарку в R2
+// UploadAvatar загружает аватарку в R2. Объекту задается ImmutableCacheControl,
+// который R2 отдает по presigned ссылкам и из публичного bucket
 func (r *R2Client) UploadAvatar(ctx context.Context, guid string, file io.Reader, contentType string, size int64) error {
-	key := fmt.Sprintf("avatars/%s", guid)
+	key := avatarKey(guid)
 
 	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:        aws.String(r.bucketName),
@@ -57,6 +63,7 @@ func (r *R2Client) UploadAvatar(ctx context.Context, guid string, file io.Reader
 		Body:          file,
 		ContentType:   aws.String(contentType),
 		ContentLength: aws.Int64(size),
+		CacheControl:  aws.String(ImmutableCacheControl),
 	})
 
 	if err != nil {
@@ -70,13 +77,13 @@ func (r *R2Client) UploadAvatar(ctx context.Context, guid string, file io.Reader
 func (r *R2Client) GetAvatarURL(guid string) string {
 	// Для R2 обычно используется публичный URL или presigned URL
 	// Здесь возвращаем путь, который можно использовать для генерации presigned URL
-	key := fmt.Sprintf("avatars/%s", guid)
+	key := avatarKey(guid)
 	return key
 }
 
 // GetAvatarPresignedURL генерирует presigned URL для доступа к аватарке
-func (r *R2Client) GetAvatarPresignedURL(ctx context.Context, guid string, expiresIn int64) (string, error) {
-	key := fmt.Sprintf("avatars/%s", guid)
+func (r *R2Client) GetAvatarPresignedURL(ctx context.Context, guid string, signedAt time.Time, expiresIn int64) (string, error) {
+	key := avatarKey(guid)
 
 	presignClient := s3.NewPresignClient(r.client)
 	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
@@ -84,6 +91,7 @@ func (r *R2Client) GetAvatarPresignedURL(ctx context.Context, guid string, expir
 		Key:    aws.String(key),
 	}, func(opts *s3.PresignOptions) {
 		opts.Expires = time.Duration(expiresIn) * time.Second
+		opts.Presigner = fixedTimePresigner{signer: v4.NewSigner(), signedAt: signedAt}
 	})
 
 	if err != nil {
@@ -93,9 +101,80 @@ func (r *R2Client) GetAvatarPresignedURL(ctx context.Context, guid string, expir
 	return request.URL, nil
 }
 
+// fixedTimePresigner подписывает запросы заданным временем вместо текущего
+type fixedTimePresigner struct {
+	signer   *v4.Signer
+	signedAt time.Time
+}
+
+func (p fixedTimePresigner) PresignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request,
+	payloadHash string, service string, region string, _ time.Time, optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	return p.signer.PresignHTTP(ctx, credentials, r, payloadHash, service, region, p.signedAt, optFns...)
+}
+
+// GetUploadPresignedURL генерирует presigned URL для PUT. Content-Type и
+// Content-Length входят в подпись, клиент обязан передать их без изменений
+func (r *R2Client) GetUploadPresignedURL(ctx context.Context, guid, contentType string, size int64, expiresIn int64) (string, error) {
+	key := avatarKey(guid)
+
+	presignClient := s3.NewPresignClient(r.client)
+	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(r.bucketName),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = time.Duration(expiresIn) * time.Second
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate upload URL: %w", err)
+	}
+
+	return request.URL, nil
+}
+
+// OpenAvatar открывает объект аватарки для чтения
+func (r *R2Client) OpenAvatar(ctx context.Context, guid string) (io.ReadCloser, error) {
+	key := avatarKey(guid)
+
+	out, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isR2NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to get avatar from R2: %w", err)
+	}
+
+	return out.Body, nil
+}
+
+// OpenAvatarRange открывает объект аватарки для чтения с offset (заголовок Range)
+func (r *R2Client) OpenAvatarRange(ctx context.Context, guid string, offset int64) (io.ReadCloser, error) {
+	key := avatarKey(guid)
+
+	out, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+	})
+	if err != nil {
+		if isR2NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to get avatar range from R2: %w", err)
+	}
+
+	return out.Body, nil
+}
+
 // DeleteAvatar удаляет аватарку из R2
 func (r *R2Client) DeleteAvatar(ctx context.Context, guid string) error {
-	key := fmt.Sprintf("avatars/%s", guid)
+	key := avatarKey(guid)
 
 	_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(r.bucketName),
@@ -108,3 +187,114 @@ func (r *R2Client) DeleteAvatar(ctx context.Context, guid string) error {
 
 	return nil
 }
+
+// HeadAvatar получает сведения об объекте аватарки без загрузки содержимого
+func (r *R2Client) HeadAvatar(ctx context.Context, guid string) (*ObjectInfo, error) {
+	key := avatarKey(guid)
+
+	out, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isR2NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to head avatar in R2: %w", err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// CreateMultipartUpload начинает составную загрузку объекта и возвращает ее UploadId
+func (r *R2Client) CreateMultipartUpload(ctx context.Context, guid, contentType string) (string, error) {
+	out, err := r.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(r.bucketName),
+		Key:         aws.String(avatarKey(guid)),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload in R2: %w", err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart загружает часть составной загрузки и возвращает ее ETag
+func (r *R2Client) UploadPart(ctx context.Context, guid, uploadID string, partNumber int32, data io.Reader, size int64) (string, error) {
+	out, err := r.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(r.bucketName),
+		Key:           aws.String(avatarKey(guid)),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		Body:          data,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d to R2: %w", partNumber, err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// CompleteMultipartUpload собирает объект из загруженных частей
+func (r *R2Client) CompleteMultipartUpload(ctx context.Context, guid, uploadID string, parts []UploadedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			PartNumber: aws.Int32(part.Number),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	_, err := r.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(r.bucketName),
+		Key:             aws.String(avatarKey(guid)),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload in R2: %w", err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload отменяет составную загрузку и освобождает загруженные части.
+// Уже отмененная или завершенная загрузка ошибкой не считается
+func (r *R2Client) AbortMultipartUpload(ctx context.Context, guid, uploadID string) error {
+	_, err := r.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(r.bucketName),
+		Key:      aws.String(avatarKey(guid)),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		var noSuchUpload *types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			return nil
+		}
+		return fmt.Errorf("failed to abort multipart upload in R2: %w", err)
+	}
+	return nil
+}
+
+// isR2NotFound проверяет, что ошибка означает отсутствие объекта
+func isR2NotFound(err error) bool {
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		return code == "NotFound" || code == "NoSuchKey"
+	}
+	return false
+}
@@ -3,9 +3,11 @@ package clients
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -29,38 +31,169 @@ func NewRedisClient(redisURL string) (*RedisClient, error) {
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	return &RedisClient{
+	r := &RedisClient{
 		client: client,
-	}, nil
+	}
+	// Миграция не ограничена таймаутом подключения: на больших базах она долгая
+	if err := r.migrate(context.Background()); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return r, nil
 }
 
-// GetGUIDByUsername получает GUID по username
-func (r *RedisClient) GetGUIDByUsername(ctx context.Context, username string) (string, error) {
-	key := fmt.Sprintf("username:%s", username)
+// GetGUIDByUserID получает GUID текущей аватарки пользователя из current:<user_id>
+func (r *RedisClient) GetGUIDByUserID(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("current:%s", userID)
 	guid, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return "", fmt.Errorf("username not found: %s", username)
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, userID)
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to get guid by username: %w", err)
+		return "", fmt.Errorf("failed to get guid by user id: %w", err)
 	}
 	return guid, nil
 }
 
-// SetGUIDByUsername устанавливает связь username -> GUID
-func (r *RedisClient) SetGUIDByUsername(ctx context.Context, username, guid string) error {
-	key := fmt.Sprintf("username:%s", username)
-	return r.client.Set(ctx, key, guid, 0).Err()
+// usernameAvatarKey ключ GUID текущей аватарки владельца username. Копия current:<user_id>
+// под username, чтобы поиск по списку username выполнялся одним MGET. Обновляется
+// вместе с current:<user_id> и псевдонимами в одном скрипте
+func usernameAvatarKey(username string) string {
+	return fmt.Sprintf("usernameavatar:%s", username)
 }
 
+// swapAvatarScript заменяет текущую аватарку. KEYS[1] current:<user_id>,
+// KEYS[2] userid:<user_id>, KEYS[3] usernameavatar:<username>, если у пользователя
+// есть username. ARGV[1] прочитанный username, ARGV[2] новый GUID.
+// Возвращает предыдущий GUID или false, если username изменился
+var swapAvatarScript = redis.NewScript(`
+if (redis.call("GET", KEYS[2]) or "") ~= ARGV[1] then
+	return false
+end
+local old = redis.call("GET", KEYS[1]) or ""
+redis.call("SET", KEYS[1], ARGV[2])
+if KEYS[3] then
+	redis.call("SET", KEYS[3], ARGV[2])
+end
+return old
+`)
+
+// deleteAvatarScript удаляет текущую аватарку, ключи и ARGV[1] как в swapAvatarScript
+var deleteAvatarScript = redis.NewScript(`
+if (redis.call("GET", KEYS[2]) or "") ~= ARGV[1] then
+	return false
+end
+redis.call("DEL", KEYS[1])
+if KEYS[3] then
+	redis.call("DEL", KEYS[3])
+end
+return 1
+`)
+
+// runAvatarScript выполняет swapAvatarScript или deleteAvatarScript с ключом
+// usernameavatar: текущего username пользователя. Если username изменился между
+// чтением и выполнением скрипта, попытка повторяется
+func (r *RedisClient) runAvatarScript(ctx context.Context, script *redis.Script, userID string, args ...any) (*redis.Cmd, error) {
+	userIDKey := fmt.Sprintf("userid:%s", userID)
+
+	for range aliasAttempts {
+		username, err := r.client.Get(ctx, userIDKey).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		keys := []string{fmt.Sprintf("current:%s", userID), userIDKey}
+		if username != "" {
+			keys = append(keys, usernameAvatarKey(username))
+		}
+		cmd := script.Run(ctx, r.client, keys, append([]any{username}, args...)...)
+		if cmd.Err() == redis.Nil {
+			continue
+		}
+		return cmd, cmd.Err()
+	}
+	return nil, errAliasChanged
+}
+
+// SwapGUIDByUserID атомарно заменяет текущую аватарку пользователя и возвращает
+// предыдущий GUID (пустая строка, если аватарки не было)
+func (r *RedisClient) SwapGUIDByUserID(ctx context.Context, userID, guid string) (string, error) {
+	cmd, err := r.runAvatarScript(ctx, swapAvatarScript, userID, guid)
+	if err == nil {
+		var oldGUID string
+		if oldGUID, err = cmd.Text(); err == nil {
+			return oldGUID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to swap avatar mapping: %w", err)
+}
+
+// DeleteAvatarMapping удаляет current:<user_id>
+func (r *RedisClient) DeleteAvatarMapping(ctx context.Context, userID string) error {
+	if _, err := r.runAvatarScript(ctx, deleteAvatarScript, userID); err != nil {
+		return fmt.Errorf("failed to delete avatar mapping: %w", err)
+	}
+	return nil
+}
+
+// GetGUIDByUsername получает GUID текущей аватарки владельца username
+func (r *RedisClient) GetGUIDByUsername(ctx context.Context, username string) (string, error) {
+	guid, err := r.client.Get(ctx, usernameAvatarKey(username)).Result()
+	if err == redis.Nil {
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, username)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get guid by username: %w", err)
+	}
+	return guid, nil
+}
+
+// Источники аватарки (AvatarMetadata.Source)
+const (
+	AvatarSourceUpload   = "upload"
+	AvatarSourceURL      = "url"
+	AvatarSourceTelegram = "telegram"
+	AvatarSourceGravatar = "gravatar"
+	// AvatarSourceOAuthPrefix префикс источника для OAuth провайдеров: "oauth:google"
+	AvatarSourceOAuthPrefix = "oauth:"
+)
+
+// Видимость аватарки (AvatarMetadata.Visibility)
+const (
+	AvatarVisibilityPublic  = "public"
+	AvatarVisibilityFriends = "friends"
+	AvatarVisibilityPrivate = "private"
+)
+
 // AvatarMetadata метаданные аватарки
 type AvatarMetadata struct {
-	GUID       string    `json:"guid"`
+	GUID string `json:"guid"`
+	// ObjectID SHA-256 содержимого, под которым хранится объект. Одинаковые
+	// аватарки разделяют объект; пусто у аватарок, сохраненных как <guid>
+	ObjectID string `json:"object_id,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	// Username username владельца на момент загрузки, после смены username не обновляется
 	Username   string    `json:"username"`
 	Filename   string    `json:"filename"`
 	Size       int64     `json:"size"`
 	MimeType   string    `json:"mime_type"`
 	UploadedAt time.Time `json:"uploaded_at"`
+	// Variants размеры сгенерированных квадратных копий (объекты <object_id>_<size>)
+	Variants []int `json:"variants,omitempty"`
+	// Crop область исходного изображения, из которой получена аватарка
+	Crop *imaging.CropRect `json:"crop,omitempty"`
+	// Source откуда получена аватарка: upload, url, telegram, gravatar, oauth:<provider>
+	Source string `json:"source,omitempty"`
+	// Visibility кому видна аватарка: public (по умолчанию), friends, private
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// StorageID возвращает идентификатор объекта аватарки в хранилище
+func (m *AvatarMetadata) StorageID() string {
+	if m.ObjectID != "" {
+		return m.ObjectID
+	}
+	return m.GUID
 }
 
 // GetAvatarMetadata получает метаданные аватарки по GUID
@@ -68,7 +201,7 @@ func (r *RedisClient) GetAvatarMetadata(ctx context.Context, guid string) (*Avat
 	key := fmt.Sprintf("avatar:%s", guid)
 	data, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, fmt.Errorf("avatar metadata not found: %s", guid)
+		return nil, fmt.Errorf("%w: %s", ErrMetadataNotFound, guid)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get avatar metadata: %w", err)
@@ -82,6 +215,38 @@ func (r *RedisClient) GetAvatarMetadata(ctx context.Context, guid string) (*Avat
 	return &metadata, nil
 }
 
+// GetAvatarsMetadata получает метаданные для списка GUID одним MGET
+func (r *RedisClient) GetAvatarsMetadata(ctx context.Context, guids []string) (map[string]*AvatarMetadata, error) {
+	result := make(map[string]*AvatarMetadata)
+	if len(guids) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(guids))
+	for i, guid := range guids {
+		keys[i] = fmt.Sprintf("avatar:%s", guid)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatars metadata: %w", err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var metadata AvatarMetadata
+		if err := json.Unmarshal([]byte(data), &metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		}
+		result[guids[i]] = &metadata
+	}
+
+	return result, nil
+}
+
 // SetAvatarMetadata устанавливает метаданные аватарки
 func (r *RedisClient) SetAvatarMetadata(ctx context.Context, metadata *AvatarMetadata) error {
 	key := fmt.Sprintf("avatar:%s", metadata.GUID)
@@ -99,26 +264,442 @@ func (r *RedisClient) DeleteAvatarMetadata(ctx context.Context, guid string) err
 	return r.client.Del(ctx, key).Err()
 }
 
-// GetGUIDsByUsernames получает GUIDs для списка username
+// acquireObjectScript увеличивает счетчик ссылок, если на объекте нет метки удаления,
+// иначе возвращает -1
+var acquireObjectScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return -1
+end
+return redis.call("INCR", KEYS[1])
+`)
+
+// releaseObjectScript уменьшает счетчик ссылок, а когда ссылок не осталось,
+// удаляет ключ и ставит метку удаления на ARGV[1] миллисекунд
+var releaseObjectScript = redis.NewScript(`
+local refs = redis.call("DECR", KEYS[1])
+if refs <= 0 then
+	redis.call("DEL", KEYS[1])
+	redis.call("SET", KEYS[2], "1", "PX", ARGV[1])
+end
+return refs
+`)
+
+// objectRefsKeys ключи счетчика ссылок и метки удаления объекта
+func objectRefsKeys(objectID string) []string {
+	return []string{fmt.Sprintf("objectrefs:%s", objectID), fmt.Sprintf("objectdeleting:%s", objectID)}
+}
+
+// AcquireObject увеличивает счетчик ссылок objectrefs:<id>, если объект не удаляется
+func (r *RedisClient) AcquireObject(ctx context.Context, objectID string) (int64, error) {
+	refs, err := acquireObjectScript.Run(ctx, r.client, objectRefsKeys(objectID)).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire object: %w", err)
+	}
+	if refs < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrObjectDeleting, objectID)
+	}
+	return refs, nil
+}
+
+// ReleaseObject атомарно уменьшает счетчик ссылок objectrefs:<id>
+func (r *RedisClient) ReleaseObject(ctx context.Context, objectID string) (int64, error) {
+	refs, err := releaseObjectScript.Run(ctx, r.client, objectRefsKeys(objectID), ObjectDeletionLease.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to release object: %w", err)
+	}
+	return refs, nil
+}
+
+// FinishObjectDeletion удаляет метку objectdeleting:<id>
+func (r *RedisClient) FinishObjectDeletion(ctx context.Context, objectID string) error {
+	key := fmt.Sprintf("objectdeleting:%s", objectID)
+	return r.client.Del(ctx, key).Err()
+}
+
+// pushHistoryScript добавляет GUID в начало списка истории без повторов,
+// обрезает список до ARGV[2] элементов и возвращает не поместившиеся GUID
+var pushHistoryScript = redis.NewScript(`
+redis.call("LREM", KEYS[1], 0, ARGV[1])
+redis.call("LPUSH", KEYS[1], ARGV[1])
+local depth = tonumber(ARGV[2])
+local evicted = redis.call("LRANGE", KEYS[1], depth, -1)
+if depth > 0 then
+	redis.call("LTRIM", KEYS[1], 0, depth - 1)
+else
+	redis.call("DEL", KEYS[1])
+end
+return evicted
+`)
+
+// PushAvatarHistory добавляет GUID в список userhistory:<user_id>
+func (r *RedisClient) PushAvatarHistory(ctx context.Context, userID, guid string, depth int) ([]string, error) {
+	key := fmt.Sprintf("userhistory:%s", userID)
+	evicted, err := pushHistoryScript.Run(ctx, r.client, []string{key}, guid, depth).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to push avatar history: %w", err)
+	}
+	return evicted, nil
+}
+
+// GetAvatarHistory возвращает список userhistory:<user_id>
+func (r *RedisClient) GetAvatarHistory(ctx context.Context, userID string) ([]string, error) {
+	key := fmt.Sprintf("userhistory:%s", userID)
+	guids, err := r.client.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatar history: %w", err)
+	}
+	return guids, nil
+}
+
+// RemoveAvatarHistory удаляет GUID из списка userhistory:<user_id>
+func (r *RedisClient) RemoveAvatarHistory(ctx context.Context, userID, guid string) error {
+	key := fmt.Sprintf("userhistory:%s", userID)
+	if err := r.client.LRem(ctx, key, 0, guid).Err(); err != nil {
+		return fmt.Errorf("failed to remove avatar history: %w", err)
+	}
+	return nil
+}
+
+// GetGUIDsByUsernames получает GUIDs для списка username одним MGET
 func (r *RedisClient) GetGUIDsByUsernames(ctx context.Context, usernames []string) (map[string]string, error) {
 	result := make(map[string]string)
+	if len(usernames) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = usernameAvatarKey(username)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guids by usernames: %w", err)
+	}
+
+	// Не найденные username возвращаются как nil и пропускаются
+	for i, value := range values {
+		if guid, ok := value.(string); ok {
+			result[usernames[i]] = guid
+		}
+	}
+
+	return result, nil
+}
+
+// aliasAttempts сколько раз повторяется запись псевдонима, если затронутые ключи
+// изменились между их чтением и выполнением скрипта
+const aliasAttempts = 5
+
+// errAliasChanged ключи псевдонима менялись при каждой из aliasAttempts попыток
+var errAliasChanged = errors.New("username keys changed concurrently")
 
-	for _, username := range usernames {
-		guid, err := r.GetGUIDByUsername(ctx, username)
+// setUsernameScript переносит псевдоним. KEYS[1] userid:<user_id>, KEYS[2] username:<username>,
+// KEYS[3] current:<user_id>, KEYS[4] usernameavatar:<username>, далее username: и
+// usernameavatar: прежнего username, если он меняется, и userid:<прежний владелец>,
+// если username принадлежал другому пользователю. ARGV[1] ID пользователя,
+// ARGV[2] username, ARGV[3] и ARGV[4] прочитанные прежний username и прежний
+// владелец, по которым составлены ключи. Если они изменились, скрипт ничего не
+// меняет и возвращает false. Иначе возвращает прежний username пользователя
+var setUsernameScript = redis.NewScript(`
+if (redis.call("GET", KEYS[1]) or "") ~= ARGV[3] or (redis.call("GET", KEYS[2]) or "") ~= ARGV[4] then
+	return false
+end
+local n = 5
+if ARGV[3] ~= "" and ARGV[3] ~= ARGV[2] then
+	if redis.call("GET", KEYS[n]) == ARGV[1] then
+		redis.call("DEL", KEYS[n], KEYS[n + 1])
+	end
+	n = n + 2
+end
+if ARGV[4] ~= "" and ARGV[4] ~= ARGV[1] then
+	redis.call("DEL", KEYS[n])
+end
+redis.call("SET", KEYS[1], ARGV[2])
+redis.call("SET", KEYS[2], ARGV[1])
+local current = redis.call("GET", KEYS[3])
+if current then
+	redis.call("SET", KEYS[4], current)
+else
+	redis.call("DEL", KEYS[4])
+end
+return ARGV[3]
+`)
+
+// SetUsername атомарно обновляет username:<username> -> ID, userid:<user_id> -> username
+// и переносит usernameavatar: на новый username.
+// Ключи прежнего username и прежнего владельца читаются заранее и передаются
+// скрипту; если до выполнения скрипта они изменились, запись повторяется
+func (r *RedisClient) SetUsername(ctx context.Context, userID, username string) (string, error) {
+	userIDKey := fmt.Sprintf("userid:%s", userID)
+	usernameKey := fmt.Sprintf("username:%s", username)
+
+	for range aliasAttempts {
+		values, err := r.client.MGet(ctx, userIDKey, usernameKey).Result()
 		if err != nil {
-			// Пропускаем не найденные username
+			return "", fmt.Errorf("failed to read username: %w", err)
+		}
+		previous, _ := values[0].(string)
+		owner, _ := values[1].(string)
+
+		keys := []string{userIDKey, usernameKey, fmt.Sprintf("current:%s", userID), usernameAvatarKey(username)}
+		if previous != "" && previous != username {
+			keys = append(keys, fmt.Sprintf("username:%s", previous), usernameAvatarKey(previous))
+		}
+		if owner != "" && owner != userID {
+			keys = append(keys, fmt.Sprintf("userid:%s", owner))
+		}
+
+		err = setUsernameScript.Run(ctx, r.client, keys, userID, username, previous, owner).Err()
+		if err == redis.Nil {
 			continue
 		}
-		result[username] = guid
+		if err != nil {
+			return "", fmt.Errorf("failed to set username: %w", err)
+		}
+		return previous, nil
+	}
+	return "", fmt.Errorf("failed to set username: %w", errAliasChanged)
+}
+
+// GetUsernameByUserID получает username по ID пользователя
+func (r *RedisClient) GetUsernameByUserID(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("userid:%s", userID)
+	username, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", fmt.Errorf("%w: %s", ErrUserIDNotFound, userID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get username by user id: %w", err)
+	}
+	return username, nil
+}
+
+// GetUsernamesByUserIDs получает username для списка ID пользователей одним MGET
+func (r *RedisClient) GetUsernamesByUserIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = fmt.Sprintf("userid:%s", userID)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usernames by user ids: %w", err)
+	}
+
+	for i, value := range values {
+		if username, ok := value.(string); ok {
+			result[userIDs[i]] = username
+		}
 	}
 
 	return result, nil
 }
 
-// DeleteUsernameMapping удаляет связь username -> GUID
-func (r *RedisClient) DeleteUsernameMapping(ctx context.Context, username string) error {
-	key := fmt.Sprintf("username:%s", username)
-	return r.client.Del(ctx, key).Err()
+// GetPendingUpload получает незавершенную загрузку по ID
+func (r *RedisClient) GetPendingUpload(ctx context.Context, id string) (*PendingUpload, error) {
+	key := fmt.Sprintf("upload:%s", id)
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending upload: %w", err)
+	}
+
+	var upload PendingUpload
+	if err := json.Unmarshal([]byte(data), &upload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pending upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// pendingUploadRetention сколько запись о загрузке хранится после истечения,
+// чтобы фоновая очистка успела удалить оставшиеся в хранилище данные
+const pendingUploadRetention = 24 * time.Hour
+
+// uploadsExpiryKey sorted set ID загрузок со временем истечения в качестве score
+const uploadsExpiryKey = "uploads:expiry"
+
+// SetPendingUpload сохраняет незавершенную загрузку и добавляет ее в индекс истечения
+func (r *RedisClient) SetPendingUpload(ctx context.Context, upload *PendingUpload) error {
+	key := fmt.Sprintf("upload:%s", upload.ID)
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending upload: %w", err)
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, time.Until(upload.ExpiresAt)+pendingUploadRetention)
+		pipe.ZAdd(ctx, uploadsExpiryKey, redis.Z{Score: float64(upload.ExpiresAt.Unix()), Member: upload.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set pending upload: %w", err)
+	}
+	return nil
+}
+
+// DeletePendingUpload удаляет незавершенную загрузку
+func (r *RedisClient) DeletePendingUpload(ctx context.Context, id string) error {
+	key := fmt.Sprintf("upload:%s", id)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZRem(ctx, uploadsExpiryKey, id)
+		return nil
+	})
+	return err
+}
+
+// ListExpiredUploads возвращает загрузки, истекшие до before, по индексу истечения.
+// ID, чьи записи уже удалены по TTL, убираются из индекса
+func (r *RedisClient) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*PendingUpload, error) {
+	ids, err := r.client.ZRangeByScore(ctx, uploadsExpiryKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprintf("(%d", before.Unix()),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf("upload:%s", id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired uploads: %w", err)
+	}
+
+	var uploads []*PendingUpload
+	var stale []any
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+		var upload PendingUpload
+		if err := json.Unmarshal([]byte(data), &upload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal pending upload: %w", err)
+		}
+		uploads = append(uploads, &upload)
+	}
+
+	if len(stale) > 0 {
+		if err := r.client.ZRem(ctx, uploadsExpiryKey, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to clean uploads expiry index: %w", err)
+		}
+	}
+	return uploads, nil
+}
+
+// GetDeletedAvatar получает удаленную аватарку пользователя
+func (r *RedisClient) GetDeletedAvatar(ctx context.Context, userID string) (*DeletedAvatar, error) {
+	key := fmt.Sprintf("userdeleted:%s", userID)
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s", ErrDeletedAvatarNotFound, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted avatar: %w", err)
+	}
+
+	var deleted DeletedAvatar
+	if err := json.Unmarshal([]byte(data), &deleted); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal deleted avatar: %w", err)
+	}
+	return &deleted, nil
+}
+
+// deletionsExpiryKey sorted set ID пользователей с удаленными аватарками со временем
+// окончательного удаления в качестве score
+const deletionsExpiryKey = "userdeleted:expiry"
+
+// SetDeletedAvatar сохраняет удаленную аватарку и добавляет ее в индекс истечения.
+// Запись хранится без TTL: ее удаляет фоновая очистка вместе с файлами
+func (r *RedisClient) SetDeletedAvatar(ctx context.Context, deleted *DeletedAvatar) error {
+	key := fmt.Sprintf("userdeleted:%s", deleted.UserID)
+	data, err := json.Marshal(deleted)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deleted avatar: %w", err)
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, 0)
+		pipe.ZAdd(ctx, deletionsExpiryKey, redis.Z{Score: float64(deleted.PurgeAt.Unix()), Member: deleted.UserID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set deleted avatar: %w", err)
+	}
+	return nil
+}
+
+// DeleteDeletedAvatar удаляет запись об удаленной аватарке пользователя
+func (r *RedisClient) DeleteDeletedAvatar(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("userdeleted:%s", userID)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZRem(ctx, deletionsExpiryKey, userID)
+		return nil
+	})
+	return err
+}
+
+// ListExpiredDeletions возвращает удаленные аватарки с истекшим сроком по индексу истечения.
+// ID без записи убираются из индекса
+func (r *RedisClient) ListExpiredDeletions(ctx context.Context, before time.Time, limit int) ([]*DeletedAvatar, error) {
+	userIDs, err := r.client.ZRangeByScore(ctx, deletionsExpiryKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprintf("(%d", before.Unix()),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired deletions: %w", err)
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = fmt.Sprintf("userdeleted:%s", userID)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired deletions: %w", err)
+	}
+
+	var deletions []*DeletedAvatar
+	var stale []any
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			stale = append(stale, userIDs[i])
+			continue
+		}
+		var deleted DeletedAvatar
+		if err := json.Unmarshal([]byte(data), &deleted); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal deleted avatar: %w", err)
+		}
+		deletions = append(deletions, &deleted)
+	}
+
+	if len(stale) > 0 {
+		if err := r.client.ZRem(ctx, deletionsExpiryKey, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to clean deletions expiry index: %w", err)
+		}
+	}
+	return deletions, nil
 }
 
 func (r *RedisClient) Close() error {
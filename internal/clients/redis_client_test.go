@@ -0,0 +1,164 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisClient запускает miniredis и подключает к нему RedisClient
+func newTestRedisClient(t *testing.T) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client, err := NewRedisClient("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestRedisSetUsername(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisClient(t)
+
+	if previous, err := store.SetUsername(ctx, "1", "alice"); err != nil || previous != "" {
+		t.Fatalf("SetUsername(1, alice) = %q, %v", previous, err)
+	}
+	if previous, err := store.SetUsername(ctx, "1", "alice2"); err != nil || previous != "alice" {
+		t.Fatalf("SetUsername(1, alice2) = %q, %v, want alice", previous, err)
+	}
+	// Прежний username освобождается
+	if server.Exists("username:alice") {
+		t.Fatalf("previous username alias was not removed")
+	}
+
+	// username переходит к последнему заявившему его пользователю
+	if previous, err := store.SetUsername(ctx, "2", "alice2"); err != nil || previous != "" {
+		t.Fatalf("SetUsername(2, alice2) = %q, %v", previous, err)
+	}
+	if _, err := store.GetUsernameByUserID(ctx, "1"); !errors.Is(err, ErrUserIDNotFound) {
+		t.Fatalf("GetUsernameByUserID(1) error = %v, want ErrUserIDNotFound", err)
+	}
+	usernames, err := store.GetUsernamesByUserIDs(ctx, []string{"1", "2"})
+	if err != nil || len(usernames) != 1 || usernames["2"] != "alice2" {
+		t.Fatalf("GetUsernamesByUserIDs = %v, %v, want only 2 -> alice2", usernames, err)
+	}
+	if owner, _ := server.Get("username:alice2"); owner != "2" {
+		t.Fatalf("username:alice2 = %q, want 2", owner)
+	}
+}
+
+func TestRedisMigrateUserIDKeys(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	// Ключи до привязки аватарок к ID: alice сменила username на alice2, но событие
+	// не обработано, у bob удаленная аватарка
+	server.Set("username:alice", "g1")
+	server.Set("username:alice2", "g2")
+	server.Set("avatar:g1", `{"guid":"g1","user_id":"1","username":"alice"}`)
+	server.Set("avatar:g2", `{"guid":"g2","user_id":"1","username":"alice2"}`)
+	server.Set("avatar:g0", `{"guid":"g0","user_id":"1","username":"alice"}`)
+	server.Set("userid:1", "alice2")
+	server.Lpush("history:alice", "g0")
+	server.Set("avatar:g3", `{"guid":"g3","user_id":"2","username":"bob"}`)
+	server.Set("deleted:bob", `{"guid":"g3","deleted_at":"2026-01-01T00:00:00Z","purge_at":"2026-01-08T00:00:00Z"}`)
+	server.ZAdd("deleted:expiry", 1767830400, "bob")
+
+	store, err := NewRedisClient("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	defer store.Close()
+
+	if guid, err := store.GetGUIDByUserID(ctx, "1"); err != nil || guid != "g2" {
+		t.Fatalf("GetGUIDByUserID(1) = %q, %v, want g2", guid, err)
+	}
+	if guid, err := store.GetGUIDByUsername(ctx, "alice2"); err != nil || guid != "g2" {
+		t.Fatalf("GetGUIDByUsername(alice2) = %q, %v, want g2", guid, err)
+	}
+	if _, err := store.GetGUIDByUsername(ctx, "alice"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername(alice) error = %v, want ErrUsernameNotFound", err)
+	}
+
+	// Аватарка под устаревшим username уходит в историю
+	history, err := store.GetAvatarHistory(ctx, "1")
+	if err != nil || len(history) != 2 || history[0] != "g1" || history[1] != "g0" {
+		t.Fatalf("GetAvatarHistory(1) = %v, %v, want [g1 g0]", history, err)
+	}
+
+	deleted, err := store.GetDeletedAvatar(ctx, "2")
+	if err != nil || deleted.GUID != "g3" || deleted.UserID != "2" {
+		t.Fatalf("GetDeletedAvatar(2) = %+v, %v", deleted, err)
+	}
+	for _, key := range []string{"history:alice", "deleted:bob", "deleted:expiry"} {
+		if server.Exists(key) {
+			t.Errorf("legacy key %s was not removed", key)
+		}
+	}
+	if version, _ := server.Get("schema:version"); version != "1" {
+		t.Fatalf("schema:version = %q, want 1", version)
+	}
+}
+
+func TestRedisGetGUIDsByUsernames(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisClient(t)
+
+	if _, err := store.SwapGUIDByUserID(ctx, "1", "g1"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if _, err := store.SetUsername(ctx, "1", "alice"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := store.SetUsername(ctx, "2", "bob"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+
+	// Поиск выполняется одной командой
+	commands := server.CommandCount()
+	guids, err := store.GetGUIDsByUsernames(ctx, []string{"alice", "bob", "carol"})
+	if err != nil || len(guids) != 1 || guids["alice"] != "g1" {
+		t.Fatalf("GetGUIDsByUsernames = %v, %v, want only alice -> g1", guids, err)
+	}
+	if n := server.CommandCount() - commands; n != 1 {
+		t.Fatalf("GetGUIDsByUsernames made %d commands, want 1", n)
+	}
+
+	// Аватарка следует за пользователем при смене аватарки и username
+	if old, err := store.SwapGUIDByUserID(ctx, "1", "g2"); err != nil || old != "g1" {
+		t.Fatalf("SwapGUIDByUserID = %q, %v, want g1", old, err)
+	}
+	if _, err := store.SetUsername(ctx, "1", "alice2"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := store.SwapGUIDByUserID(ctx, "2", "g3"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	guids, err = store.GetGUIDsByUsernames(ctx, []string{"alice", "alice2", "bob"})
+	if err != nil || len(guids) != 2 || guids["alice2"] != "g2" || guids["bob"] != "g3" {
+		t.Fatalf("GetGUIDsByUsernames = %v, %v, want alice2 -> g2, bob -> g3", guids, err)
+	}
+
+	// username без аватарки у нового владельца не отдает аватарку прежнего
+	if _, err := store.SetUsername(ctx, "3", "alice2"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := store.GetGUIDByUsername(ctx, "alice2"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername(alice2) error = %v, want ErrUsernameNotFound", err)
+	}
+
+	if err := store.DeleteAvatarMapping(ctx, "2"); err != nil {
+		t.Fatalf("DeleteAvatarMapping: %v", err)
+	}
+	if _, err := store.GetGUIDByUsername(ctx, "bob"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername(bob) error = %v, want ErrUsernameNotFound", err)
+	}
+	if guid, err := store.GetGUIDByUserID(ctx, "1"); err != nil || guid != "g2" {
+		t.Fatalf("GetGUIDByUserID(1) = %q, %v, want g2", guid, err)
+	}
+}
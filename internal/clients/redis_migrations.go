@@ -0,0 +1,339 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSchemaVersion актуальная версия схемы ключей, хранится в schema:version
+const redisSchemaVersion = 1
+
+const (
+	redisSchemaVersionKey = "schema:version"
+	// redisMigrationLockKey не дает нескольким экземплярам мигрировать одновременно
+	redisMigrationLockKey = "schema:migrating"
+	redisMigrationLockTTL = 10 * time.Minute
+)
+
+// migrate переводит ключи на актуальную схему. Пока миграцию выполняет другой
+// экземпляр, ждет ее завершения
+func (r *RedisClient) migrate(ctx context.Context) error {
+	for {
+		migrated, err := r.schemaMigrated(ctx)
+		if err != nil || migrated {
+			return err
+		}
+
+		locked, err := r.client.SetNX(ctx, redisMigrationLockKey, "1", redisMigrationLockTTL).Result()
+		if err != nil {
+			return fmt.Errorf("failed to lock redis migration: %w", err)
+		}
+		if locked {
+			defer r.client.Del(context.WithoutCancel(ctx), redisMigrationLockKey)
+
+			// Другой экземпляр мог завершить миграцию до получения блокировки
+			if migrated, err := r.schemaMigrated(ctx); err != nil || migrated {
+				return err
+			}
+			if err := r.migrateUserIDKeys(ctx); err != nil {
+				return fmt.Errorf("failed to apply redis migration %d: %w", redisSchemaVersion, err)
+			}
+			return r.client.Set(ctx, redisSchemaVersionKey, redisSchemaVersion, 0).Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for redis migration: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// schemaMigrated проверяет, что схема ключей актуальна
+func (r *RedisClient) schemaMigrated(ctx context.Context) (bool, error) {
+	version, err := r.client.Get(ctx, redisSchemaVersionKey).Int()
+	if err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to read redis schema version: %w", err)
+	}
+	return version >= redisSchemaVersion, nil
+}
+
+// legacyUserIndex индекс userid:<user_id> -> username, прочитанный при миграции
+type legacyUserIndex struct {
+	usernames map[string]string
+	owners    map[string]string
+}
+
+// set сохраняет username пользователя, у которого его еще нет в индексе
+func (idx *legacyUserIndex) set(ctx context.Context, r *RedisClient, userID, username string) error {
+	if err := r.client.Set(ctx, fmt.Sprintf("userid:%s", userID), username, 0).Err(); err != nil {
+		return err
+	}
+	idx.usernames[userID] = username
+	idx.owners[username] = userID
+	return nil
+}
+
+// migrateUserIDKeys переводит ключи, созданные до привязки аватарок к ID пользователя:
+// username:<username> -> GUID становится current:<user_id> -> GUID и псевдонимом
+// username:<username> -> ID, history:<username> и deleted:<username> - ключами
+// userhistory:<user_id> и userdeleted:<user_id>. Владелец определяется по метаданным
+// аватарки, для аватарок без ID - по индексу userid:. Записи без владельца удаляются.
+// В конце для каждого username заполняется usernameavatar:<username>
+func (r *RedisClient) migrateUserIDKeys(ctx context.Context) error {
+	idx := &legacyUserIndex{usernames: make(map[string]string), owners: make(map[string]string)}
+	keys, err := r.scanKeys(ctx, "userid:*")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		username, err := r.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		userID := strings.TrimPrefix(key, "userid:")
+		idx.usernames[userID] = username
+		idx.owners[username] = userID
+	}
+
+	if err := r.migrateCurrentAvatars(ctx, idx); err != nil {
+		return err
+	}
+	if err := r.migrateAvatarHistory(ctx, idx); err != nil {
+		return err
+	}
+	if err := r.migrateDeletedAvatars(ctx, idx); err != nil {
+		return err
+	}
+	return r.migrateUsernameAvatars(ctx, idx)
+}
+
+// migrateCurrentAvatars переводит username:<username> -> GUID
+func (r *RedisClient) migrateCurrentAvatars(ctx context.Context, idx *legacyUserIndex) error {
+	// Ключи собираются заранее: псевдонимы записываются под тем же префиксом
+	keys, err := r.scanKeys(ctx, "username:*")
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "username:")
+		guid, err := r.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Уже псевдоним: предыдущий запуск миграции прервался
+		if owner, ok := idx.owners[username]; ok && owner == guid {
+			continue
+		}
+
+		userID, err := r.legacyOwner(ctx, idx, username, guid)
+		if err != nil {
+			return err
+		}
+		if userID == "" {
+			log.Printf("[REDIS] WARNING: avatar %s of %s has no user id and is dropped", guid, username)
+		} else {
+			if _, ok := idx.usernames[userID]; !ok {
+				if err := idx.set(ctx, r, userID, username); err != nil {
+					return err
+				}
+			}
+			// Текущей становится аватарка под актуальным username пользователя,
+			// аватарка под устаревшим (переименование не обработано) уходит в историю
+			if err := r.migrateCurrentAvatar(ctx, userID, guid, idx.usernames[userID] == username); err != nil {
+				return err
+			}
+		}
+
+		if owner, ok := idx.owners[username]; ok {
+			err = r.client.Set(ctx, key, owner, 0).Err()
+		} else {
+			err = r.client.Del(ctx, key).Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCurrentAvatar делает guid текущей аватаркой пользователя. Без replace
+// guid становится текущей, только если ее еще нет, иначе уходит в историю
+func (r *RedisClient) migrateCurrentAvatar(ctx context.Context, userID, guid string, replace bool) error {
+	key := fmt.Sprintf("current:%s", userID)
+	history := fmt.Sprintf("userhistory:%s", userID)
+	if !replace {
+		set, err := r.client.SetNX(ctx, key, guid, 0).Result()
+		if err != nil || set {
+			return err
+		}
+		return r.client.LPush(ctx, history, guid).Err()
+	}
+
+	old, err := r.client.SetArgs(ctx, key, guid, redis.SetArgs{Get: true}).Result()
+	if err == redis.Nil || old == guid {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.client.LPush(ctx, history, old).Err()
+}
+
+// migrateAvatarHistory переводит history:<username> в userhistory:<user_id>
+func (r *RedisClient) migrateAvatarHistory(ctx context.Context, idx *legacyUserIndex) error {
+	keys, err := r.scanKeys(ctx, "history:*")
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "history:")
+		guids, err := r.client.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		userID, err := r.legacyOwner(ctx, idx, username, guids...)
+		if err != nil {
+			return err
+		}
+		if userID == "" {
+			log.Printf("[REDIS] WARNING: avatar history of %s has no user id and is dropped", username)
+		} else if len(guids) > 0 {
+			// Порядок сохраняется: в начале списка последняя аватарка
+			values := make([]any, len(guids))
+			for i, guid := range guids {
+				values[i] = guid
+			}
+			if err := r.client.RPush(ctx, fmt.Sprintf("userhistory:%s", userID), values...).Err(); err != nil {
+				return err
+			}
+		}
+
+		if err := r.client.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateDeletedAvatars переводит deleted:<username> и индекс deleted:expiry
+// в userdeleted:<user_id> и userdeleted:expiry
+func (r *RedisClient) migrateDeletedAvatars(ctx context.Context, idx *legacyUserIndex) error {
+	const legacyExpiryKey = "deleted:expiry"
+
+	keys, err := r.scanKeys(ctx, "deleted:*")
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key == legacyExpiryKey {
+			continue
+		}
+		username := strings.TrimPrefix(key, "deleted:")
+		data, err := r.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var deleted DeletedAvatar
+		if err := json.Unmarshal([]byte(data), &deleted); err != nil {
+			return fmt.Errorf("failed to unmarshal deleted avatar %s: %w", username, err)
+		}
+		deleted.UserID, err = r.legacyOwner(ctx, idx, username, deleted.GUID)
+		if err != nil {
+			return err
+		}
+
+		if deleted.UserID == "" {
+			log.Printf("[REDIS] WARNING: deleted avatar %s of %s has no user id and is dropped", deleted.GUID, username)
+		} else {
+			// Восстановить можно только последнюю удаленную аватарку
+			existing, err := r.GetDeletedAvatar(ctx, deleted.UserID)
+			if err != nil && !errors.Is(err, ErrDeletedAvatarNotFound) {
+				return err
+			}
+			if existing == nil || existing.DeletedAt.Before(deleted.DeletedAt) {
+				err = r.SetDeletedAvatar(ctx, &deleted)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := r.client.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	}
+	return r.client.Del(ctx, legacyExpiryKey).Err()
+}
+
+// migrateUsernameAvatars копирует current:<user_id> в usernameavatar:<username>
+func (r *RedisClient) migrateUsernameAvatars(ctx context.Context, idx *legacyUserIndex) error {
+	for userID, username := range idx.usernames {
+		if idx.owners[username] != userID {
+			continue
+		}
+		guid, err := r.client.Get(ctx, fmt.Sprintf("current:%s", userID)).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.client.Set(ctx, usernameAvatarKey(username), guid, 0).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyOwner возвращает ID владельца записи username по метаданным первой
+// аватарки из guids, у которой он есть, или по индексу userid:
+func (r *RedisClient) legacyOwner(ctx context.Context, idx *legacyUserIndex, username string, guids ...string) (string, error) {
+	for _, guid := range guids {
+		metadata, err := r.GetAvatarMetadata(ctx, guid)
+		if errors.Is(err, ErrMetadataNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if metadata.UserID != "" {
+			return metadata.UserID, nil
+		}
+	}
+	return idx.owners[username], nil
+}
+
+// scanKeys возвращает все ключи по шаблону
+func (r *RedisClient) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", pattern, err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,281 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrRemoteFetchForbidden URL запрещен политикой: схема, хост или адрес вне разрешенных
+	ErrRemoteFetchForbidden = errors.New("remote URL is not allowed")
+	// ErrRemoteFileTooLarge удаленный файл больше разрешенного размера
+	ErrRemoteFileTooLarge = errors.New("remote file is too large")
+	// ErrRemoteFetchFailed удаленный сервер недоступен или вернул ошибку
+	ErrRemoteFetchFailed = errors.New("failed to download remote file")
+)
+
+// fetchPolicyError отказ по политике загрузки, errors.Is(err, ErrRemoteFetchForbidden)
+type fetchPolicyError struct {
+	reason string
+}
+
+func forbidden(format string, args ...any) error {
+	return &fetchPolicyError{reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *fetchPolicyError) Error() string {
+	return ErrRemoteFetchForbidden.Error() + ": " + e.reason
+}
+
+func (e *fetchPolicyError) Is(target error) bool {
+	return target == ErrRemoteFetchForbidden
+}
+
+// RemoteStatusError удаленный сервер ответил не 200, errors.Is(err, ErrRemoteFetchFailed)
+type RemoteStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *RemoteStatusError) Error() string {
+	return ErrRemoteFetchFailed.Error() + ": remote server returned " + e.Status
+}
+
+func (e *RemoteStatusError) Is(target error) bool {
+	return target == ErrRemoteFetchFailed
+}
+
+// RemoteFetcherConfig параметры загрузки файлов по внешним URL
+type RemoteFetcherConfig struct {
+	// AllowedSchemes разрешенные схемы URL (например https)
+	AllowedSchemes []string
+	// AllowedHosts разрешенные хосты; "*.example.com" разрешает поддомены.
+	// Пустой список разрешает любой публичный хост
+	AllowedHosts []string
+	// AllowPrivateNetworks разрешает адреса локальных сетей (только для разработки)
+	AllowPrivateNetworks bool
+	// MaxRedirects максимальное число перенаправлений
+	MaxRedirects int
+	// ConnectTimeout таймаут установки соединения (TCP и TLS)
+	ConnectTimeout time.Duration
+	// Timeout общий таймаут запроса, включая чтение тела
+	Timeout time.Duration
+	// MaxBytes максимальный размер тела ответа
+	MaxBytes int64
+}
+
+// RemoteFile файл, загруженный по внешнему URL
+type RemoteFile struct {
+	Data        []byte
+	ContentType string
+	// Filename имя файла из пути URL (после перенаправлений)
+	Filename string
+}
+
+// RemoteFetcher загружает файлы по внешним URL с защитой от SSRF.
+// Адрес проверяется в момент подключения, после разрешения DNS,
+// поэтому подмена DNS между проверкой и запросом (DNS rebinding) не помогает
+type RemoteFetcher struct {
+	client *http.Client
+	config RemoteFetcherConfig
+}
+
+func NewRemoteFetcher(cfg RemoteFetcherConfig) *RemoteFetcher {
+	f := &RemoteFetcher{config: cfg}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.ConnectTimeout,
+		Control: f.checkDialAddress,
+	}
+
+	transport := &http.Transport{
+		// Прокси из окружения не используется: иначе проверялся бы адрес прокси
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	f.client = &http.Client{
+		Transport:     transport,
+		Timeout:       cfg.Timeout,
+		CheckRedirect: f.checkRedirect,
+	}
+	return f
+}
+
+// Fetch загружает файл по URL. Тело читается не больше MaxBytes
+func (f *RemoteFetcher) Fetch(ctx context.Context, rawURL string) (*RemoteFile, error) {
+	target, err := f.checkURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, forbidden("invalid URL")
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// Отдаем только причину отказа, без разрешенного адреса из ошибки подключения
+		var policyErr *fetchPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, policyErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRemoteFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RemoteStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if resp.ContentLength > f.config.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, maximum is %d", ErrRemoteFileTooLarge, resp.ContentLength, f.config.MaxBytes)
+	}
+
+	// Content-Length может отсутствовать или быть неверным, поэтому ограничиваем чтение
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.config.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRemoteFetchFailed, err)
+	}
+	if int64(len(data)) > f.config.MaxBytes {
+		return nil, fmt.Errorf("%w: maximum is %d bytes", ErrRemoteFileTooLarge, f.config.MaxBytes)
+	}
+
+	return &RemoteFile{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+		Filename:    remoteFilename(resp.Request.URL),
+	}, nil
+}
+
+// checkURL проверяет схему и хост URL по спискам разрешенных
+func (f *RemoteFetcher) checkURL(rawURL string) (*url.URL, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, forbidden("invalid URL")
+	}
+
+	if !containsFold(f.config.AllowedSchemes, target.Scheme) {
+		return nil, forbidden("scheme %q is not allowed", target.Scheme)
+	}
+	if target.User != nil {
+		return nil, forbidden("credentials in URL are not allowed")
+	}
+
+	host := strings.ToLower(target.Hostname())
+	if host == "" {
+		return nil, forbidden("host is required")
+	}
+	if !hostAllowed(f.config.AllowedHosts, host) {
+		return nil, forbidden("host %q is not allowed", host)
+	}
+
+	return target, nil
+}
+
+// checkRedirect ограничивает число перенаправлений и проверяет каждый новый URL
+func (f *RemoteFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.config.MaxRedirects {
+		return forbidden("too many redirects")
+	}
+	_, err := f.checkURL(req.URL.String())
+	return err
+}
+
+// checkDialAddress вызывается перед каждым подключением с уже разрешенным IP адресом
+func (f *RemoteFetcher) checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if f.config.AllowPrivateNetworks {
+		return nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return forbidden("invalid destination address")
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return forbidden("destination address is not public")
+	}
+	return nil
+}
+
+// nonPublicPrefixes специальные диапазоны, не покрытые методами netip.Addr
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "этот" хост
+	netip.MustParsePrefix("100.64.0.0/10"),   // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // тестирование производительности
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // зарезервировано и broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64 может вести во внутреннюю IPv4 сеть
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"), // документация
+}
+
+// isPublicAddr возвращает true для глобально маршрутизируемых адресов
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func hostAllowed(allowed []string, host string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteFilename(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "avatar"
+	}
+	return name
+}
@@ -0,0 +1,299 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testFetcherConfig разрешает loopback, чтобы обращаться к httptest серверу
+func testFetcherConfig() RemoteFetcherConfig {
+	return RemoteFetcherConfig{
+		AllowedSchemes:       []string{"http", "https"},
+		AllowPrivateNetworks: true,
+		MaxRedirects:         3,
+		ConnectTimeout:       time.Second,
+		Timeout:              2 * time.Second,
+		MaxBytes:             1024,
+	}
+}
+
+func TestRemoteFetcherFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	file, err := NewRemoteFetcher(testFetcherConfig()).Fetch(context.Background(), server.URL+"/photos/avatar.png")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(file.Data) != "image" || file.ContentType != "image/png" || file.Filename != "avatar.png" {
+		t.Fatalf("unexpected file: data=%q type=%q name=%q", file.Data, file.ContentType, file.Filename)
+	}
+}
+
+func TestRemoteFetcherRejectsPrivateAddressAtDial(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	cfg := testFetcherConfig()
+	cfg.AllowPrivateNetworks = false
+	fetcher := NewRemoteFetcher(cfg)
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	// localhost проходит проверку URL и отклоняется только после разрешения DNS
+	for _, rawURL := range []string{server.URL, fmt.Sprintf("http://localhost:%d/", port)} {
+		_, err := fetcher.Fetch(context.Background(), rawURL)
+		if !errors.Is(err, ErrRemoteFetchForbidden) {
+			t.Errorf("Fetch(%s) error = %v, want ErrRemoteFetchForbidden", rawURL, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "127.0.0.1") {
+			t.Errorf("Fetch(%s) error leaks resolved address: %v", rawURL, err)
+		}
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("server received %d requests, want 0", hits.Load())
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestRemoteFetcherRedirectLimit(t *testing.T) {
+	// /redirect/N перенаправляет N раз, затем отдает файл
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	cfg := testFetcherConfig()
+	cfg.MaxRedirects = 2
+	fetcher := NewRemoteFetcher(cfg)
+
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/redirect/2"); err != nil {
+		t.Fatalf("Fetch within redirect limit: %v", err)
+	}
+	_, err := fetcher.Fetch(context.Background(), server.URL+"/redirect/3")
+	if !errors.Is(err, ErrRemoteFetchForbidden) {
+		t.Fatalf("Fetch over redirect limit error = %v, want ErrRemoteFetchForbidden", err)
+	}
+}
+
+func TestRemoteFetcherRedirectToDisallowedHost(t *testing.T) {
+	var hits atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/target" {
+			hits.Add(1)
+			w.Write([]byte("image"))
+			return
+		}
+		port := server.Listener.Addr().(*net.TCPAddr).Port
+		http.Redirect(w, r, fmt.Sprintf("http://localhost:%d/target", port), http.StatusFound)
+	}))
+	defer server.Close()
+
+	cfg := testFetcherConfig()
+	cfg.AllowedHosts = []string{"127.0.0.1"}
+
+	_, err := NewRemoteFetcher(cfg).Fetch(context.Background(), server.URL+"/start")
+	if !errors.Is(err, ErrRemoteFetchForbidden) {
+		t.Fatalf("Fetch error = %v, want ErrRemoteFetchForbidden", err)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("redirect target was requested")
+	}
+}
+
+func TestRemoteFetcherSchemeAndHostAllowlist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		schemes []string
+		hosts   []string
+		url     string
+		allowed bool
+	}{
+		{"scheme not allowed", []string{"https"}, nil, server.URL, false},
+		{"scheme allowed", []string{"HTTP"}, nil, server.URL, true},
+		{"unsupported scheme", []string{"http", "https"}, nil, "file:///etc/passwd", false},
+		{"host not allowed", []string{"http"}, []string{"example.com"}, server.URL, false},
+		{"host allowed", []string{"http"}, []string{"example.com", "127.0.0.1"}, server.URL, true},
+		{"credentials in URL", []string{"http"}, nil, strings.Replace(server.URL, "http://", "http://user:pass@", 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testFetcherConfig()
+			cfg.AllowedSchemes = tt.schemes
+			cfg.AllowedHosts = tt.hosts
+
+			_, err := NewRemoteFetcher(cfg).Fetch(context.Background(), tt.url)
+			if tt.allowed && err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrRemoteFetchForbidden) {
+				t.Fatalf("Fetch error = %v, want ErrRemoteFetchForbidden", err)
+			}
+		})
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"t.me", "*.telegram.org"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"t.me", true},
+		{"api.telegram.org", true},
+		{"cdn4.telegram.org", true},
+		{"telegram.org", false},
+		{"evil-telegram.org", false},
+		{"t.me.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := hostAllowed(allowed, tt.host); got != tt.want {
+			t.Errorf("hostAllowed(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	if !hostAllowed(nil, "any.example.com") {
+		t.Errorf("empty allowlist must allow any host")
+	}
+}
+
+func TestRemoteFetcherMaxBytes(t *testing.T) {
+	body := strings.Repeat("x", 2048)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Write([]byte(body[:1024]))
+		case "/content-length":
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write([]byte(body))
+		case "/chunked":
+			// Flush до записи тела отключает Content-Length
+			w.(http.Flusher).Flush()
+			for i := 0; i < len(body); i += 256 {
+				w.Write([]byte(body[i : i+256]))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewRemoteFetcher(testFetcherConfig())
+
+	file, err := fetcher.Fetch(context.Background(), server.URL+"/small")
+	if err != nil || len(file.Data) != 1024 {
+		t.Fatalf("Fetch at limit: err=%v", err)
+	}
+	for _, path := range []string{"/content-length", "/chunked"} {
+		_, err := fetcher.Fetch(context.Background(), server.URL+path)
+		if !errors.Is(err, ErrRemoteFileTooLarge) {
+			t.Errorf("Fetch(%s) error = %v, want ErrRemoteFileTooLarge", path, err)
+		}
+	}
+}
+
+func TestRemoteFetcherConnectTimeout(t *testing.T) {
+	// Сервер принимает TCP соединение, но не отвечает на TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cfg := testFetcherConfig()
+	cfg.ConnectTimeout = 200 * time.Millisecond
+	cfg.Timeout = 10 * time.Second
+
+	start := time.Now()
+	_, err = NewRemoteFetcher(cfg).Fetch(context.Background(), "https://"+listener.Addr().String()+"/")
+	if !errors.Is(err, ErrRemoteFetchFailed) {
+		t.Fatalf("Fetch error = %v, want ErrRemoteFetchFailed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("connect timeout not applied: took %v", elapsed)
+	}
+}
+
+func TestRemoteFetcherTotalTimeout(t *testing.T) {
+	// Заголовки отправляются сразу, тело - никогда
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	cfg := testFetcherConfig()
+	cfg.Timeout = 300 * time.Millisecond
+
+	start := time.Now()
+	_, err := NewRemoteFetcher(cfg).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrRemoteFetchFailed) {
+		t.Fatalf("Fetch error = %v, want ErrRemoteFetchFailed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("total timeout not applied: took %v", elapsed)
+	}
+}
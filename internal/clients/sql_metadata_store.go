@@ -0,0 +1,981 @@
+package clients
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// SQLMetadataStore хранит метаданные аватарок в SQL базе (SQLite или Postgres).
+// Записи об удаленных аватарках не удаляются, а помечаются deleted_at,
+// поэтому таблица avatars содержит всю историю загрузок
+type SQLMetadataStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// sqlMigration версионированная миграция схемы. В тексте {{timestamp}}
+// заменяется на тип временной метки для конкретного диалекта
+type sqlMigration struct {
+	version    int
+	statements []string
+}
+
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE avatars (
+				guid        TEXT PRIMARY KEY,
+				user_id     TEXT NOT NULL DEFAULT '',
+				username    TEXT NOT NULL,
+				filename    TEXT NOT NULL DEFAULT '',
+				size        BIGINT NOT NULL,
+				mime_type   TEXT NOT NULL,
+				uploaded_at {{timestamp}} NOT NULL,
+				deleted_at  {{timestamp}} NULL
+			)`,
+			`CREATE INDEX idx_avatars_username ON avatars (username)`,
+			`CREATE INDEX idx_avatars_user_id ON avatars (user_id)`,
+			`CREATE INDEX idx_avatars_uploaded_at ON avatars (uploaded_at)`,
+			// Текущая аватарка принадлежит ID пользователя, username - только псевдоним
+			`CREATE TABLE user_avatars (
+				user_id    TEXT PRIMARY KEY,
+				guid       TEXT NOT NULL,
+				updated_at {{timestamp}} NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`ALTER TABLE avatars ADD COLUMN variants TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			// Область обрезки в формате "x,y,width,height"
+			`ALTER TABLE avatars ADD COLUMN crop TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 4,
+		statements: []string{
+			`ALTER TABLE avatars ADD COLUMN source TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 5,
+		statements: []string{
+			`CREATE TABLE pending_uploads (
+				id           TEXT PRIMARY KEY,
+				user_id      TEXT NOT NULL DEFAULT '',
+				username     TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size         BIGINT NOT NULL,
+				created_at   {{timestamp}} NOT NULL,
+				expires_at   {{timestamp}} NOT NULL
+			)`,
+			`CREATE INDEX idx_pending_uploads_expires_at ON pending_uploads (expires_at)`,
+		},
+	},
+	{
+		version: 6,
+		statements: []string{
+			`ALTER TABLE pending_uploads ADD COLUMN kind TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE pending_uploads ADD COLUMN filename TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE pending_uploads ADD COLUMN upload_offset BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE pending_uploads ADD COLUMN multipart_id TEXT NOT NULL DEFAULT ''`,
+			// Загруженные части в JSON: [{"number":1,"etag":"...","size":5242880}]
+			`ALTER TABLE pending_uploads ADD COLUMN parts TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE pending_uploads ADD COLUMN metadata TEXT NOT NULL DEFAULT ''`,
+			// Параметры обрезки в JSON: {"rect":{...}} или {"focal":{...}}
+			`ALTER TABLE pending_uploads ADD COLUMN crop TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 7,
+		statements: []string{
+			// SHA-256 содержимого; пусто у аватарок, хранящихся как <guid>
+			`ALTER TABLE avatars ADD COLUMN object_id TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE object_refs (
+				object_id TEXT PRIMARY KEY,
+				refs      BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 8,
+		statements: []string{
+			`CREATE TABLE user_avatar_history (
+				user_id  TEXT NOT NULL,
+				guid     TEXT NOT NULL,
+				added_at {{timestamp}} NOT NULL,
+				PRIMARY KEY (user_id, guid)
+			)`,
+		},
+	},
+	{
+		version: 9,
+		statements: []string{
+			`CREATE TABLE user_deleted_avatars (
+				user_id    TEXT PRIMARY KEY,
+				guid       TEXT NOT NULL,
+				deleted_at {{timestamp}} NOT NULL,
+				purge_at   {{timestamp}} NOT NULL
+			)`,
+			`CREATE INDEX idx_user_deleted_avatars_purge_at ON user_deleted_avatars (purge_at)`,
+		},
+	},
+	{
+		version: 10,
+		statements: []string{
+			`ALTER TABLE avatars ADD COLUMN visibility TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 11,
+		statements: []string{
+			`CREATE TABLE user_id_mappings (
+				user_id    TEXT PRIMARY KEY,
+				username   TEXT NOT NULL,
+				updated_at {{timestamp}} NOT NULL
+			)`,
+			// username принадлежит одному пользователю
+			`CREATE UNIQUE INDEX idx_user_id_mappings_username ON user_id_mappings (username)`,
+		},
+	},
+	{
+		version: 12,
+		statements: []string{
+			// Метка удаления: запись с refs = 0 хранится, пока удаляются файлы объекта
+			`ALTER TABLE object_refs ADD COLUMN deleting_until {{timestamp}} NULL`,
+		},
+	},
+}
+
+// avatarColumns колонки таблицы avatars в порядке scanAvatar
+const avatarColumns = `guid, user_id, username, filename, size, mime_type, uploaded_at, variants, crop, source, object_id, visibility`
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAvatar(row rowScanner) (*AvatarMetadata, error) {
+	var metadata AvatarMetadata
+	var variants, crop string
+	err := row.Scan(
+		&metadata.GUID,
+		&metadata.UserID,
+		&metadata.Username,
+		&metadata.Filename,
+		&metadata.Size,
+		&metadata.MimeType,
+		&metadata.UploadedAt,
+		&variants,
+		&crop,
+		&metadata.Source,
+		&metadata.ObjectID,
+		&metadata.Visibility,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.Variants, err = decodeIntList(variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse variants: %w", err)
+	}
+	metadata.Crop, err = decodeCrop(crop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse crop: %w", err)
+	}
+	return &metadata, nil
+}
+
+// NewSQLMetadataStore подключается к базе и применяет миграции.
+// driver: "sqlite" или "postgres"
+func NewSQLMetadataStore(driver, dsn string) (*SQLMetadataStore, error) {
+	var driverName string
+	switch driver {
+	case "sqlite":
+		driverName = "sqlite"
+	case "postgres":
+		driverName = "pgx"
+	default:
+		return nil, fmt.Errorf("unsupported SQL driver: %s", driver)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if driver == "sqlite" {
+		// SQLite допускает только одного писателя, сериализуем доступ
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	store := &SQLMetadataStore{
+		db:      db,
+		dialect: driver,
+	}
+
+	if err := store.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// migrate применяет недостающие миграции, каждую в отдельной транзакции
+func (s *SQLMetadataStore) migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.schema(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at {{timestamp}} NOT NULL
+	)`))
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, migration := range sqlMigrations {
+		if migration.version <= current {
+			continue
+		}
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", migration.version, err)
+		}
+
+		for _, stmt := range migration.statements {
+			if _, err := tx.ExecContext(ctx, s.schema(stmt)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to apply migration %d: %w", migration.version, err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`),
+			migration.version, time.Now().UTC())
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", migration.version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", migration.version, err)
+		}
+	}
+
+	return nil
+}
+
+// GetGUIDByUserID получает GUID текущей аватарки пользователя
+func (s *SQLMetadataStore) GetGUIDByUserID(ctx context.Context, userID string) (string, error) {
+	var guid string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT guid FROM user_avatars WHERE user_id = ?`), userID).Scan(&guid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, userID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get guid by user id: %w", err)
+	}
+	return guid, nil
+}
+
+// SwapGUIDByUserID в транзакции заменяет текущую аватарку пользователя и возвращает предыдущий GUID
+func (s *SQLMetadataStore) SwapGUIDByUserID(ctx context.Context, userID, guid string) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT guid FROM user_avatars WHERE user_id = ?`
+	if s.dialect == "postgres" {
+		query += ` FOR UPDATE`
+	}
+
+	var oldGUID string
+	err = tx.QueryRowContext(ctx, s.rebind(query), userID).Scan(&oldGUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to read avatar mapping: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO user_avatars (user_id, guid, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET guid = excluded.guid, updated_at = excluded.updated_at`),
+		userID, guid, time.Now().UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to swap avatar mapping: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit avatar mapping: %w", err)
+	}
+
+	return oldGUID, nil
+}
+
+// DeleteAvatarMapping удаляет связь пользователя с текущей аватаркой
+func (s *SQLMetadataStore) DeleteAvatarMapping(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM user_avatars WHERE user_id = ?`), userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete avatar mapping: %w", err)
+	}
+	return nil
+}
+
+// GetGUIDByUsername получает GUID текущей аватарки владельца username
+func (s *SQLMetadataStore) GetGUIDByUsername(ctx context.Context, username string) (string, error) {
+	var guid string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT c.guid FROM user_id_mappings u
+		JOIN user_avatars c ON c.user_id = u.user_id WHERE u.username = ?`), username).Scan(&guid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrUsernameNotFound, username)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get guid by username: %w", err)
+	}
+	return guid, nil
+}
+
+// GetGUIDsByUsernames получает GUIDs для списка username одним запросом
+func (s *SQLMetadataStore) GetGUIDsByUsernames(ctx context.Context, usernames []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(usernames) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := inClause(usernames)
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT u.username, c.guid FROM user_id_mappings u
+		JOIN user_avatars c ON c.user_id = u.user_id WHERE u.username IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guids by usernames: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username, guid string
+		if err := rows.Scan(&username, &guid); err != nil {
+			return nil, fmt.Errorf("failed to scan avatar mapping: %w", err)
+		}
+		result[username] = guid
+	}
+
+	return result, rows.Err()
+}
+
+// SetUsername в транзакции делает username псевдонимом пользователя userID.
+// Строка user_id_mappings хранит обе стороны связи, поэтому прежний username
+// освобождается той же записью
+func (s *SQLMetadataStore) SetUsername(ctx context.Context, userID, username string) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT username FROM user_id_mappings WHERE user_id = ?`
+	if s.dialect == "postgres" {
+		query += ` FOR UPDATE`
+	}
+
+	var previous string
+	err = tx.QueryRowContext(ctx, s.rebind(query), userID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to read user id mapping: %w", err)
+	}
+
+	// username уходит от прежнего владельца
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM user_id_mappings WHERE username = ? AND user_id <> ?`), username, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to release username: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO user_id_mappings (user_id, username, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET username = excluded.username, updated_at = excluded.updated_at`),
+		userID, username, time.Now().UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to set user id mapping: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit user id mapping: %w", err)
+	}
+	return previous, nil
+}
+
+// GetUsernameByUserID получает username по ID пользователя
+func (s *SQLMetadataStore) GetUsernameByUserID(ctx context.Context, userID string) (string, error) {
+	var username string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT username FROM user_id_mappings WHERE user_id = ?`), userID).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrUserIDNotFound, userID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get username by user id: %w", err)
+	}
+	return username, nil
+}
+
+// GetUsernamesByUserIDs получает username для списка ID пользователей одним запросом
+func (s *SQLMetadataStore) GetUsernamesByUserIDs(ctx context.Context, userIDs []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := inClause(userIDs)
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT user_id, username FROM user_id_mappings WHERE user_id IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usernames by user ids: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, username string
+		if err := rows.Scan(&userID, &username); err != nil {
+			return nil, fmt.Errorf("failed to scan user id mapping: %w", err)
+		}
+		result[userID] = username
+	}
+
+	return result, rows.Err()
+}
+
+// GetAvatarMetadata получает метаданные аватарки по GUID
+func (s *SQLMetadataStore) GetAvatarMetadata(ctx context.Context, guid string) (*AvatarMetadata, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+avatarColumns+` FROM avatars WHERE guid = ? AND deleted_at IS NULL`), guid)
+	metadata, err := scanAvatar(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrMetadataNotFound, guid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatar metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// GetAvatarsMetadata получает метаданные для списка GUID одним запросом
+func (s *SQLMetadataStore) GetAvatarsMetadata(ctx context.Context, guids []string) (map[string]*AvatarMetadata, error) {
+	result := make(map[string]*AvatarMetadata)
+	if len(guids) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := inClause(guids)
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+avatarColumns+` FROM avatars
+		WHERE guid IN (`+placeholders+`) AND deleted_at IS NULL`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatars metadata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		metadata, err := scanAvatar(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan avatar metadata: %w", err)
+		}
+		result[metadata.GUID] = metadata
+	}
+
+	return result, rows.Err()
+}
+
+// SetAvatarMetadata устанавливает метаданные аватарки
+func (s *SQLMetadataStore) SetAvatarMetadata(ctx context.Context, metadata *AvatarMetadata) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO avatars (`+avatarColumns+`, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)
+		ON CONFLICT (guid) DO UPDATE SET
+			user_id = excluded.user_id,
+			username = excluded.username,
+			filename = excluded.filename,
+			size = excluded.size,
+			mime_type = excluded.mime_type,
+			uploaded_at = excluded.uploaded_at,
+			variants = excluded.variants,
+			crop = excluded.crop,
+			source = excluded.source,
+			object_id = excluded.object_id,
+			visibility = excluded.visibility,
+			deleted_at = NULL`),
+		metadata.GUID,
+		metadata.UserID,
+		metadata.Username,
+		metadata.Filename,
+		metadata.Size,
+		metadata.MimeType,
+		metadata.UploadedAt.UTC(),
+		encodeIntList(metadata.Variants),
+		encodeCrop(metadata.Crop),
+		metadata.Source,
+		metadata.ObjectID,
+		metadata.Visibility,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set avatar metadata: %w", err)
+	}
+	return nil
+}
+
+// DeleteAvatarMetadata помечает метаданные аватарки удаленными (запись остается в истории)
+func (s *SQLMetadataStore) DeleteAvatarMetadata(ctx context.Context, guid string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`UPDATE avatars SET deleted_at = ? WHERE guid = ? AND deleted_at IS NULL`),
+		time.Now().UTC(), guid)
+	if err != nil {
+		return fmt.Errorf("failed to delete avatar metadata: %w", err)
+	}
+	return nil
+}
+
+// AcquireObject увеличивает счетчик ссылок на объект, если на нем нет
+// действующей метки удаления
+func (s *SQLMetadataStore) AcquireObject(ctx context.Context, objectID string) (int64, error) {
+	var refs int64
+	err := s.db.QueryRowContext(ctx, s.rebind(`INSERT INTO object_refs (object_id, refs) VALUES (?, 1)
+		ON CONFLICT (object_id) DO UPDATE SET refs = object_refs.refs + 1, deleting_until = NULL
+		WHERE object_refs.deleting_until IS NULL OR object_refs.deleting_until < ?
+		RETURNING refs`), objectID, time.Now().UTC()).Scan(&refs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrObjectDeleting, objectID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire object: %w", err)
+	}
+	return refs, nil
+}
+
+// ReleaseObject в транзакции уменьшает счетчик ссылок, а когда ссылок не осталось,
+// обнуляет счетчик и ставит метку удаления
+func (s *SQLMetadataStore) ReleaseObject(ctx context.Context, objectID string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var refs int64
+	err = tx.QueryRowContext(ctx, s.rebind(`UPDATE object_refs SET refs = refs - 1 WHERE object_id = ? RETURNING refs`),
+		objectID).Scan(&refs)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to release object: %w", err)
+	}
+
+	if refs <= 0 {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO object_refs (object_id, refs, deleting_until) VALUES (?, 0, ?)
+			ON CONFLICT (object_id) DO UPDATE SET refs = 0, deleting_until = excluded.deleting_until`),
+			objectID, time.Now().Add(ObjectDeletionLease).UTC())
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark object deleting: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit object refs: %w", err)
+	}
+	return refs, nil
+}
+
+// FinishObjectDeletion удаляет запись об объекте, если на него так и не появилось ссылок
+func (s *SQLMetadataStore) FinishObjectDeletion(ctx context.Context, objectID string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM object_refs WHERE object_id = ? AND refs <= 0`), objectID)
+	if err != nil {
+		return fmt.Errorf("failed to finish object deletion: %w", err)
+	}
+	return nil
+}
+
+// PushAvatarHistory в транзакции добавляет GUID в историю пользователя и удаляет
+// записи сверх depth
+func (s *SQLMetadataStore) PushAvatarHistory(ctx context.Context, userID, guid string, depth int) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO user_avatar_history (user_id, guid, added_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, guid) DO UPDATE SET added_at = excluded.added_at`),
+		userID, guid, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to push avatar history: %w", err)
+	}
+
+	history, err := s.queryAvatarHistory(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) <= depth {
+		return nil, tx.Commit()
+	}
+
+	evicted := history[max(depth, 0):]
+	placeholders, args := inClause(evicted)
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM user_avatar_history WHERE user_id = ? AND guid IN (`+placeholders+`)`),
+		append([]any{userID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to trim avatar history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit avatar history: %w", err)
+	}
+	return evicted, nil
+}
+
+// GetAvatarHistory возвращает историю пользователя, начиная с последней аватарки
+func (s *SQLMetadataStore) GetAvatarHistory(ctx context.Context, userID string) ([]string, error) {
+	return s.queryAvatarHistory(ctx, s.db, userID)
+}
+
+// queryer общий интерфейс *sql.DB и *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (s *SQLMetadataStore) queryAvatarHistory(ctx context.Context, q queryer, userID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, s.rebind(`SELECT guid FROM user_avatar_history WHERE user_id = ?
+		ORDER BY added_at DESC, guid`), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatar history: %w", err)
+	}
+	defer rows.Close()
+
+	var guids []string
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			return nil, fmt.Errorf("failed to scan avatar history: %w", err)
+		}
+		guids = append(guids, guid)
+	}
+	return guids, rows.Err()
+}
+
+// RemoveAvatarHistory удаляет GUID из истории пользователя
+func (s *SQLMetadataStore) RemoveAvatarHistory(ctx context.Context, userID, guid string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM user_avatar_history WHERE user_id = ? AND guid = ?`), userID, guid)
+	if err != nil {
+		return fmt.Errorf("failed to remove avatar history: %w", err)
+	}
+	return nil
+}
+
+// deletedAvatarColumns колонки таблицы user_deleted_avatars в порядке scanDeletedAvatar
+const deletedAvatarColumns = `user_id, guid, deleted_at, purge_at`
+
+func scanDeletedAvatar(row rowScanner) (*DeletedAvatar, error) {
+	var deleted DeletedAvatar
+	if err := row.Scan(&deleted.UserID, &deleted.GUID, &deleted.DeletedAt, &deleted.PurgeAt); err != nil {
+		return nil, err
+	}
+	return &deleted, nil
+}
+
+// GetDeletedAvatar получает удаленную аватарку пользователя
+func (s *SQLMetadataStore) GetDeletedAvatar(ctx context.Context, userID string) (*DeletedAvatar, error) {
+	deleted, err := scanDeletedAvatar(s.db.QueryRowContext(ctx, s.rebind(`SELECT `+deletedAvatarColumns+`
+		FROM user_deleted_avatars WHERE user_id = ?`), userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrDeletedAvatarNotFound, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted avatar: %w", err)
+	}
+	return deleted, nil
+}
+
+// SetDeletedAvatar сохраняет удаленную аватарку
+func (s *SQLMetadataStore) SetDeletedAvatar(ctx context.Context, deleted *DeletedAvatar) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO user_deleted_avatars (`+deletedAvatarColumns+`) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			guid = excluded.guid,
+			deleted_at = excluded.deleted_at,
+			purge_at = excluded.purge_at`),
+		deleted.UserID, deleted.GUID, deleted.DeletedAt.UTC(), deleted.PurgeAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to set deleted avatar: %w", err)
+	}
+	return nil
+}
+
+// DeleteDeletedAvatar удаляет запись об удаленной аватарке пользователя
+func (s *SQLMetadataStore) DeleteDeletedAvatar(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM user_deleted_avatars WHERE user_id = ?`), userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete deleted avatar: %w", err)
+	}
+	return nil
+}
+
+// ListExpiredDeletions возвращает удаленные аватарки с истекшим сроком, начиная с самых старых
+func (s *SQLMetadataStore) ListExpiredDeletions(ctx context.Context, before time.Time, limit int) ([]*DeletedAvatar, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+deletedAvatarColumns+`
+		FROM user_deleted_avatars WHERE purge_at < ? ORDER BY purge_at LIMIT ?`), before.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired deletions: %w", err)
+	}
+	defer rows.Close()
+
+	var deletions []*DeletedAvatar
+	for rows.Next() {
+		deleted, err := scanDeletedAvatar(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deleted avatar: %w", err)
+		}
+		deletions = append(deletions, deleted)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list expired deletions: %w", err)
+	}
+	return deletions, nil
+}
+
+// pendingUploadColumns колонки таблицы pending_uploads в порядке scanPendingUpload
+const pendingUploadColumns = `id, kind, user_id, username, content_type, size, created_at, expires_at,
+	filename, upload_offset, multipart_id, parts, metadata, crop`
+
+func scanPendingUpload(row rowScanner) (*PendingUpload, error) {
+	var upload PendingUpload
+	var parts, crop string
+	if err := row.Scan(
+		&upload.ID,
+		&upload.Kind,
+		&upload.UserID,
+		&upload.Username,
+		&upload.ContentType,
+		&upload.Size,
+		&upload.CreatedAt,
+		&upload.ExpiresAt,
+		&upload.Filename,
+		&upload.Offset,
+		&upload.MultipartID,
+		&parts,
+		&upload.Metadata,
+		&crop,
+	); err != nil {
+		return nil, err
+	}
+	if parts != "" {
+		if err := json.Unmarshal([]byte(parts), &upload.Parts); err != nil {
+			return nil, fmt.Errorf("invalid parts of upload %s: %w", upload.ID, err)
+		}
+	}
+	if crop != "" {
+		if err := json.Unmarshal([]byte(crop), &upload.Crop); err != nil {
+			return nil, fmt.Errorf("invalid crop of upload %s: %w", upload.ID, err)
+		}
+	}
+	return &upload, nil
+}
+
+// GetPendingUpload получает незавершенную загрузку по ID
+func (s *SQLMetadataStore) GetPendingUpload(ctx context.Context, id string) (*PendingUpload, error) {
+	upload, err := scanPendingUpload(s.db.QueryRowContext(ctx, s.rebind(`SELECT `+pendingUploadColumns+`
+		FROM pending_uploads WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending upload: %w", err)
+	}
+	return upload, nil
+}
+
+// SetPendingUpload сохраняет незавершенную загрузку
+func (s *SQLMetadataStore) SetPendingUpload(ctx context.Context, upload *PendingUpload) error {
+	var parts, crop string
+	if len(upload.Parts) > 0 {
+		data, err := json.Marshal(upload.Parts)
+		if err != nil {
+			return fmt.Errorf("failed to marshal upload parts: %w", err)
+		}
+		parts = string(data)
+	}
+	if upload.Crop != nil {
+		data, err := json.Marshal(upload.Crop)
+		if err != nil {
+			return fmt.Errorf("failed to marshal upload crop: %w", err)
+		}
+		crop = string(data)
+	}
+
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO pending_uploads (`+pendingUploadColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			kind = excluded.kind,
+			user_id = excluded.user_id,
+			username = excluded.username,
+			content_type = excluded.content_type,
+			size = excluded.size,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at,
+			filename = excluded.filename,
+			upload_offset = excluded.upload_offset,
+			multipart_id = excluded.multipart_id,
+			parts = excluded.parts,
+			metadata = excluded.metadata,
+			crop = excluded.crop`),
+		upload.ID,
+		upload.Kind,
+		upload.UserID,
+		upload.Username,
+		upload.ContentType,
+		upload.Size,
+		upload.CreatedAt.UTC(),
+		upload.ExpiresAt.UTC(),
+		upload.Filename,
+		upload.Offset,
+		upload.MultipartID,
+		parts,
+		upload.Metadata,
+		crop,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set pending upload: %w", err)
+	}
+	return nil
+}
+
+// DeletePendingUpload удаляет незавершенную загрузку
+func (s *SQLMetadataStore) DeletePendingUpload(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM pending_uploads WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending upload: %w", err)
+	}
+	return nil
+}
+
+// ListExpiredUploads возвращает загрузки, истекшие до before, начиная с самых старых
+func (s *SQLMetadataStore) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*PendingUpload, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+pendingUploadColumns+`
+		FROM pending_uploads WHERE expires_at < ? ORDER BY expires_at LIMIT ?`), before.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []*PendingUpload
+	for rows.Next() {
+		upload, err := scanPendingUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pending upload: %w", err)
+		}
+		uploads = append(uploads, upload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+	return uploads, nil
+}
+
+func (s *SQLMetadataStore) Close() error {
+	return s.db.Close()
+}
+
+// rebind заменяет плейсхолдеры ? на $1, $2, ... для Postgres
+func (s *SQLMetadataStore) rebind(query string) string {
+	if s.dialect != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// inClause строит список плейсхолдеров и аргументов для WHERE ... IN (...)
+func inClause(values []string) (string, []any) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return placeholders, args
+}
+
+// encodeIntList сериализует список чисел в строку вида "64,128"
+func encodeIntList(values []int) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeIntList(value string) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ",")
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = n
+	}
+	return values, nil
+}
+
+// schema подставляет типы, зависящие от диалекта
+func (s *SQLMetadataStore) schema(stmt string) string {
+	timestamp := "TIMESTAMP"
+	if s.dialect == "postgres" {
+		timestamp = "TIMESTAMPTZ"
+	}
+	return strings.ReplaceAll(stmt, "{{timestamp}}", timestamp)
+}
+
+func encodeCrop(crop *imaging.CropRect) string {
+	if crop == nil {
+		return ""
+	}
+	return encodeIntList([]int{crop.X, crop.Y, crop.Width, crop.Height})
+}
+
+func decodeCrop(value string) (*imaging.CropRect, error) {
+	values, err := decodeIntList(value)
+	if err != nil || values == nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("expected 4 values, got %d", len(values))
+	}
+	return &imaging.CropRect{X: values[0], Y: values[1], Width: values[2], Height: values[3]}, nil
+}
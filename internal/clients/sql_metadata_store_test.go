@@ -0,0 +1,159 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSQLStore открывает SQLite базу во временном каталоге
+func newTestSQLStore(t *testing.T) (*SQLMetadataStore, string) {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "avatars.db")
+	store, err := NewSQLMetadataStore("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("NewSQLMetadataStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, dsn
+}
+
+func TestSQLMetadataStoreMigrations(t *testing.T) {
+	ctx := context.Background()
+	store, dsn := newTestSQLStore(t)
+
+	var version, count int
+	if err := store.db.QueryRowContext(ctx, `SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&version, &count); err != nil {
+		t.Fatalf("read schema_migrations: %v", err)
+	}
+	last := sqlMigrations[len(sqlMigrations)-1].version
+	if version != last || count != len(sqlMigrations) {
+		t.Fatalf("schema_migrations = version %d, %d rows, want %d, %d", version, count, last, len(sqlMigrations))
+	}
+
+	if _, err := store.SetUsername(ctx, "1", "alice"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	if _, err := store.SwapGUIDByUserID(ctx, "1", "g1"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	store.Close()
+
+	// Повторное открытие не применяет миграции заново и сохраняет данные
+	reopened, err := NewSQLMetadataStore("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("NewSQLMetadataStore (reopen): %v", err)
+	}
+	defer reopened.Close()
+
+	if err := reopened.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&count); err != nil {
+		t.Fatalf("read schema_migrations: %v", err)
+	}
+	if count != len(sqlMigrations) {
+		t.Fatalf("schema_migrations has %d rows after reopen, want %d", count, len(sqlMigrations))
+	}
+	if guid, err := reopened.GetGUIDByUsername(ctx, "alice"); err != nil || guid != "g1" {
+		t.Fatalf("GetGUIDByUsername after reopen = %q, %v, want g1", guid, err)
+	}
+}
+
+func TestSQLMetadataStoreSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestSQLStore(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, deleted := range []*DeletedAvatar{
+		{UserID: "1", GUID: "g1", DeletedAt: now.Add(-2 * time.Hour), PurgeAt: now.Add(-time.Hour)},
+		{UserID: "2", GUID: "g2", DeletedAt: now.Add(-3 * time.Hour), PurgeAt: now.Add(-2 * time.Hour)},
+		{UserID: "3", GUID: "g3", DeletedAt: now, PurgeAt: now.Add(time.Hour)},
+	} {
+		if err := store.SetDeletedAvatar(ctx, deleted); err != nil {
+			t.Fatalf("SetDeletedAvatar(%s): %v", deleted.UserID, err)
+		}
+	}
+
+	deleted, err := store.GetDeletedAvatar(ctx, "1")
+	if err != nil || deleted.GUID != "g1" || !deleted.PurgeAt.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("GetDeletedAvatar(1) = %+v, %v", deleted, err)
+	}
+
+	// Повторное удаление заменяет запись пользователя
+	if err := store.SetDeletedAvatar(ctx, &DeletedAvatar{UserID: "1", GUID: "g4", DeletedAt: now, PurgeAt: now.Add(-30 * time.Minute)}); err != nil {
+		t.Fatalf("SetDeletedAvatar(1): %v", err)
+	}
+	if deleted, err := store.GetDeletedAvatar(ctx, "1"); err != nil || deleted.GUID != "g4" {
+		t.Fatalf("GetDeletedAvatar(1) = %+v, %v, want g4", deleted, err)
+	}
+
+	// Истекшие удаления возвращаются начиная с самых старых
+	expired, err := store.ListExpiredDeletions(ctx, now, 10)
+	if err != nil || len(expired) != 2 || expired[0].UserID != "2" || expired[1].UserID != "1" {
+		t.Fatalf("ListExpiredDeletions = %v, %v, want users 2 and 1", expired, err)
+	}
+	if expired, err := store.ListExpiredDeletions(ctx, now, 1); err != nil || len(expired) != 1 {
+		t.Fatalf("ListExpiredDeletions(limit 1) = %v, %v", expired, err)
+	}
+
+	if err := store.DeleteDeletedAvatar(ctx, "2"); err != nil {
+		t.Fatalf("DeleteDeletedAvatar: %v", err)
+	}
+	if _, err := store.GetDeletedAvatar(ctx, "2"); !errors.Is(err, ErrDeletedAvatarNotFound) {
+		t.Fatalf("GetDeletedAvatar(2) error = %v, want ErrDeletedAvatarNotFound", err)
+	}
+}
+
+func TestSQLMetadataStoreUsernames(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestSQLStore(t)
+
+	if _, err := store.SwapGUIDByUserID(ctx, "1", "g1"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if _, err := store.SwapGUIDByUserID(ctx, "2", "g2"); err != nil {
+		t.Fatalf("SwapGUIDByUserID: %v", err)
+	}
+	if previous, err := store.SetUsername(ctx, "1", "alice"); err != nil || previous != "" {
+		t.Fatalf("SetUsername(1, alice) = %q, %v", previous, err)
+	}
+	if _, err := store.SetUsername(ctx, "2", "bob"); err != nil {
+		t.Fatalf("SetUsername(2, bob): %v", err)
+	}
+
+	guids, err := store.GetGUIDsByUsernames(ctx, []string{"alice", "bob", "carol"})
+	if err != nil || len(guids) != 2 || guids["alice"] != "g1" || guids["bob"] != "g2" {
+		t.Fatalf("GetGUIDsByUsernames = %v, %v", guids, err)
+	}
+
+	// Смена username освобождает прежний
+	if previous, err := store.SetUsername(ctx, "1", "alice2"); err != nil || previous != "alice" {
+		t.Fatalf("SetUsername(1, alice2) = %q, %v, want alice", previous, err)
+	}
+	if _, err := store.GetGUIDByUsername(ctx, "alice"); !errors.Is(err, ErrUsernameNotFound) {
+		t.Fatalf("GetGUIDByUsername(alice) error = %v, want ErrUsernameNotFound", err)
+	}
+	if guid, err := store.GetGUIDByUsername(ctx, "alice2"); err != nil || guid != "g1" {
+		t.Fatalf("GetGUIDByUsername(alice2) = %q, %v, want g1", guid, err)
+	}
+
+	// username переходит к последнему заявившему его пользователю
+	if previous, err := store.SetUsername(ctx, "2", "alice2"); err != nil || previous != "bob" {
+		t.Fatalf("SetUsername(2, alice2) = %q, %v, want bob", previous, err)
+	}
+	if _, err := store.GetUsernameByUserID(ctx, "1"); !errors.Is(err, ErrUserIDNotFound) {
+		t.Fatalf("GetUsernameByUserID(1) error = %v, want ErrUserIDNotFound", err)
+	}
+	usernames, err := store.GetUsernamesByUserIDs(ctx, []string{"1", "2"})
+	if err != nil || len(usernames) != 1 || usernames["2"] != "alice2" {
+		t.Fatalf("GetUsernamesByUserIDs = %v, %v, want only 2 -> alice2", usernames, err)
+	}
+	if guid, err := store.GetGUIDByUsername(ctx, "alice2"); err != nil || guid != "g2" {
+		t.Fatalf("GetGUIDByUsername(alice2) = %q, %v, want g2", guid, err)
+	}
+	// Текущая аватарка принадлежит ID и не теряется вместе с username
+	if guid, err := store.GetGUIDByUserID(ctx, "1"); err != nil || guid != "g1" {
+		t.Fatalf("GetGUIDByUserID(1) = %q, %v, want g1", guid, err)
+	}
+}
@@ -0,0 +1,73 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound возвращается хранилищем, если объект отсутствует
+var ErrObjectNotFound = errors.New("object not found")
+
+// BlobStorage интерфейс хранилища файлов аватарок (R2, локальный диск или память).
+// id - идентификатор объекта внутри пространства avatars/
+type BlobStorage interface {
+	UploadAvatar(ctx context.Context, id string, file io.Reader, contentType string, size int64) error
+	DeleteAvatar(ctx context.Context, id string) error
+	// GetAvatarPresignedURL подписывает ссылку на чтение объекта временем signedAt,
+	// ссылка действует expiresIn секунд от него. Одинаковые аргументы дают одну и ту же ссылку
+	GetAvatarPresignedURL(ctx context.Context, id string, signedAt time.Time, expiresIn int64) (string, error)
+	HeadAvatar(ctx context.Context, id string) (*ObjectInfo, error)
+	OpenAvatar(ctx context.Context, id string) (io.ReadCloser, error)
+	// OpenAvatarRange открывает объект для чтения начиная с offset байт
+	OpenAvatarRange(ctx context.Context, id string, offset int64) (io.ReadCloser, error)
+	// GetUploadPresignedURL возвращает ссылку для загрузки объекта клиентом
+	// напрямую (PUT) с заданными Content-Type и размером
+	GetUploadPresignedURL(ctx context.Context, id, contentType string, size int64, expiresIn int64) (string, error)
+
+	// Составная (multipart) загрузка объекта по частям. Все части, кроме
+	// последней, должны быть не меньше MultipartMinPartSize
+	CreateMultipartUpload(ctx context.Context, id, contentType string) (string, error)
+	UploadPart(ctx context.Context, id, uploadID string, partNumber int32, data io.Reader, size int64) (string, error)
+	CompleteMultipartUpload(ctx context.Context, id, uploadID string, parts []UploadedPart) error
+	AbortMultipartUpload(ctx context.Context, id, uploadID string) error
+}
+
+// ImmutableCacheControl Cache-Control объектов аватарок. Содержимое объекта не
+// меняется: новая аватарка сохраняется под новым идентификатором
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// MultipartMinPartSize минимальный размер части составной загрузки (ограничение S3/R2)
+const MultipartMinPartSize = 5 << 20
+
+// UploadedPart загруженная часть составной загрузки
+type UploadedPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// ObjectInfo сведения об объекте в хранилище
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// avatarKey возвращает ключ объекта аватарки в хранилище
+func avatarKey(id string) string {
+	return fmt.Sprintf("avatars/%s", id)
+}
+
+// validateObjectID запрещает идентификаторы, выходящие за пределы avatars/
+func validateObjectID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return fmt.Errorf("invalid object id: %q", id)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTelegramNoPhoto у пользователя Telegram нет фото профиля (или бот не может их получить)
+	ErrTelegramNoPhoto = errors.New("telegram user has no profile photos")
+	// ErrTelegramAPI Bot API вернул ошибку или недоступен
+	ErrTelegramAPI = errors.New("telegram bot API error")
+)
+
+// TelegramClient клиент Telegram Bot API для получения фото профиля.
+// Базовый URL настраивается, чтобы вместо api.telegram.org можно было
+// использовать локальный Bot API сервер или заглушку
+type TelegramClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	maxBytes   int64
+}
+
+func NewTelegramClient(baseURL, token string, timeout time.Duration, maxBytes int64) *TelegramClient {
+	return &TelegramClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: timeout},
+		maxBytes:   maxBytes,
+	}
+}
+
+// telegramResponse общий формат ответа Bot API
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+}
+
+type telegramPhotoSize struct {
+	FileID   string `json:"file_id"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FileSize int64  `json:"file_size"`
+}
+
+type telegramUserProfilePhotos struct {
+	TotalCount int                   `json:"total_count"`
+	Photos     [][]telegramPhotoSize `json:"photos"`
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FileSize int64  `json:"file_size"`
+	FilePath string `json:"file_path"`
+}
+
+// DownloadProfilePhoto скачивает текущее фото профиля пользователя в наибольшем размере
+func (t *TelegramClient) DownloadProfilePhoto(ctx context.Context, userID int64) (*RemoteFile, error) {
+	var photos telegramUserProfilePhotos
+	err := t.call(ctx, "getUserProfilePhotos", url.Values{
+		"user_id": {strconv.FormatInt(userID, 10)},
+		"limit":   {"1"},
+	}, &photos)
+	if err != nil {
+		return nil, err
+	}
+	if len(photos.Photos) == 0 || len(photos.Photos[0]) == 0 {
+		return nil, ErrTelegramNoPhoto
+	}
+
+	// Telegram отдает фото в нескольких размерах, берем наибольший
+	largest := photos.Photos[0][0]
+	for _, size := range photos.Photos[0][1:] {
+		if size.Width*size.Height > largest.Width*largest.Height {
+			largest = size
+		}
+	}
+
+	var file telegramFile
+	if err := t.call(ctx, "getFile", url.Values{"file_id": {largest.FileID}}, &file); err != nil {
+		return nil, err
+	}
+	if file.FilePath == "" {
+		return nil, fmt.Errorf("%w: getFile returned no file_path", ErrTelegramAPI)
+	}
+	if file.FileSize > t.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, maximum is %d", ErrRemoteFileTooLarge, file.FileSize, t.maxBytes)
+	}
+
+	data, err := t.download(ctx, file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RemoteFile{
+		Data:     data,
+		Filename: path.Base(file.FilePath),
+	}, nil
+}
+
+// call вызывает метод Bot API и разбирает поле result в out
+func (t *TelegramClient) call(ctx context.Context, method string, params url.Values, out any) error {
+	endpoint := fmt.Sprintf("%s/bot%s/%s?%s", t.baseURL, t.token, method, params.Encode())
+
+	resp, err := t.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body telegramResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return fmt.Errorf("%w: %s: invalid response: %v", ErrTelegramAPI, method, err)
+	}
+	if !body.OK {
+		return fmt.Errorf("%w: %s: %d %s", ErrTelegramAPI, method, body.ErrorCode, body.Description)
+	}
+
+	if err := json.Unmarshal(body.Result, out); err != nil {
+		return fmt.Errorf("%w: %s: invalid result: %v", ErrTelegramAPI, method, err)
+	}
+	return nil
+}
+
+// download скачивает файл по file_path, читая не больше maxBytes
+func (t *TelegramClient) download(ctx context.Context, filePath string) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/file/bot%s/%s", t.baseURL, t.token, strings.TrimLeft(filePath, "/"))
+
+	resp, err := t.get(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: file download returned %s", ErrTelegramAPI, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, t.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: file download failed", ErrTelegramAPI)
+	}
+	if int64(len(data)) > t.maxBytes {
+		return nil, fmt.Errorf("%w: maximum is %d bytes", ErrRemoteFileTooLarge, t.maxBytes)
+	}
+	return data, nil
+}
+
+// get выполняет запрос. Ошибка не содержит URL, так как в нем токен бота
+func (t *TelegramClient) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid request", ErrTelegramAPI)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrTelegramAPI, err)
+	}
+	return resp, nil
+}
@@ -2,29 +2,123 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	ServerPort     string
-	R2AccountID    string
-	R2AccessKeyID  string
-	R2SecretKey    string
-	R2BucketName   string
-	R2Endpoint     string
-	RedisURL       string
+	ServerPort          string
+	PublicBaseURL       string
+	StorageBackend      string
+	LocalStorageDir     string
+	LocalStorageSecret  string
+	R2AccountID         string
+	R2AccessKeyID       string
+	R2SecretKey         string
+	R2BucketName        string
+	R2Endpoint          string
+	MetadataBackend     string
+	MetadataRedisCache  bool
+	SQLDriver           string
+	DatabaseURL         string
+	RedisURL            string
 	GRPCUserServiceAddr string
+	BatchMaxSize        int
+	AvatarOutputFormat  string
+	AvatarJPEGQuality   int
+	AvatarWebPQuality   int
+	DefaultAvatarStyle  string
+	AvatarURLStrategy   string
+	AvatarPublicBaseURL string
+	AvatarURLExpiry     time.Duration
+	AvatarURLSecret     string
+
+	MetadataCacheTTL         time.Duration
+	MetadataCacheNegativeTTL time.Duration
+
+	RemoteFetchAllowedSchemes []string
+	RemoteFetchAllowedHosts   []string
+	RemoteFetchAllowPrivate   bool
+	RemoteFetchMaxRedirects   int
+	RemoteFetchConnectTimeout time.Duration
+	RemoteFetchTimeout        time.Duration
+
+	TelegramBotToken   string
+	TelegramAPIBaseURL string
+
+	GravatarEnabled      bool
+	GravatarBaseURL      string
+	GravatarHash         string
+	OAuthAvatarProviders map[string]string
+
+	UploadPurgeInterval time.Duration
+
+	AvatarHistoryDepth  int
+	AvatarDeleteGrace   time.Duration
+	AvatarPurgeInterval time.Duration
+
+	UserEventsSecret string
 }
 
 func Load() *Config {
+	serverPort := getEnv("SERVER_PORT", "8080")
+
 	return &Config{
-		ServerPort:     getEnv("SERVER_PORT", "8080"),
-		R2AccountID:    getEnv("R2_ACCOUNT_ID", ""),
-		R2AccessKeyID:  getEnv("R2_ACCESS_KEY_ID", ""),
-		R2SecretKey:    getEnv("R2_SECRET_KEY", ""),
-		R2BucketName:   getEnv("R2_BUCKET_NAME", ""),
-		R2Endpoint:     getEnv("R2_ENDPOINT", ""),
-		RedisURL:       getEnv("REDIS_URL", ""),
+		ServerPort:          serverPort,
+		PublicBaseURL:       getEnv("PUBLIC_BASE_URL", "http://localhost:"+serverPort),
+		StorageBackend:      getEnv("STORAGE_BACKEND", "r2"),
+		LocalStorageDir:     getEnv("LOCAL_STORAGE_DIR", "./data"),
+		LocalStorageSecret:  getEnv("LOCAL_STORAGE_SECRET", ""),
+		R2AccountID:         getEnv("R2_ACCOUNT_ID", ""),
+		R2AccessKeyID:       getEnv("R2_ACCESS_KEY_ID", ""),
+		R2SecretKey:         getEnv("R2_SECRET_KEY", ""),
+		R2BucketName:        getEnv("R2_BUCKET_NAME", ""),
+		R2Endpoint:          getEnv("R2_ENDPOINT", ""),
+		MetadataBackend:     getEnv("METADATA_BACKEND", "redis"),
+		MetadataRedisCache:  getEnvBool("METADATA_REDIS_CACHE", false),
+		SQLDriver:           getEnv("SQL_DRIVER", "sqlite"),
+		DatabaseURL:         getEnv("DATABASE_URL", "file:avatars.db"),
+		RedisURL:            getEnv("REDIS_URL", ""),
 		GRPCUserServiceAddr: getEnv("GRPC_USER_SERVICE_ADDR", "localhost:50051"),
+		BatchMaxSize:        getEnvInt("AVATARS_BATCH_MAX_SIZE", 100),
+		AvatarOutputFormat:  getEnv("AVATAR_OUTPUT_FORMAT", "jpeg"),
+		AvatarJPEGQuality:   getEnvInt("AVATAR_JPEG_QUALITY", 85),
+		AvatarWebPQuality:   getEnvInt("AVATAR_WEBP_QUALITY", 80),
+		DefaultAvatarStyle:  getEnv("DEFAULT_AVATAR_STYLE", "initials"),
+		AvatarURLStrategy:   getEnv("AVATAR_URL_STRATEGY", "presigned"),
+		AvatarPublicBaseURL: getEnv("AVATAR_PUBLIC_BASE_URL", ""),
+		AvatarURLExpiry:     time.Duration(getEnvInt("AVATAR_URL_EXPIRY_SECONDS", 3600)) * time.Second,
+		AvatarURLSecret:     getEnv("AVATAR_URL_SECRET", ""),
+
+		MetadataCacheTTL:         time.Duration(getEnvPositiveInt("METADATA_CACHE_TTL_SECONDS", 300)) * time.Second,
+		MetadataCacheNegativeTTL: time.Duration(getEnvPositiveInt("METADATA_CACHE_NEGATIVE_TTL_SECONDS", 10)) * time.Second,
+
+		RemoteFetchAllowedSchemes: getEnvList("REMOTE_FETCH_ALLOWED_SCHEMES", []string{"https"}),
+		RemoteFetchAllowedHosts:   getEnvList("REMOTE_FETCH_ALLOWED_HOSTS", nil),
+		RemoteFetchAllowPrivate:   getEnvBool("REMOTE_FETCH_ALLOW_PRIVATE", false),
+		RemoteFetchMaxRedirects:   getEnvInt("REMOTE_FETCH_MAX_REDIRECTS", 3),
+		RemoteFetchConnectTimeout: time.Duration(getEnvInt("REMOTE_FETCH_CONNECT_TIMEOUT_SECONDS", 5)) * time.Second,
+		RemoteFetchTimeout:        time.Duration(getEnvInt("REMOTE_FETCH_TIMEOUT_SECONDS", 15)) * time.Second,
+
+		TelegramBotToken:   getEnv("TELEGRAM_BOT_TOKEN", ""),
+		TelegramAPIBaseURL: getEnv("TELEGRAM_API_BASE_URL", "https://api.telegram.org"),
+
+		GravatarEnabled: getEnvBool("GRAVATAR_ENABLED", true),
+		GravatarBaseURL: getEnv("GRAVATAR_BASE_URL", "https://gravatar.com"),
+		GravatarHash:    getEnv("GRAVATAR_HASH", "sha256"),
+		OAuthAvatarProviders: getEnvMap("OAUTH_AVATAR_PROVIDERS", map[string]string{
+			"google": "https://lh3.googleusercontent.com",
+			"github": "https://avatars.githubusercontent.com",
+		}),
+
+		UploadPurgeInterval: time.Duration(getEnvPositiveInt("UPLOAD_PURGE_INTERVAL_SECONDS", 600)) * time.Second,
+
+		AvatarHistoryDepth:  getEnvInt("AVATAR_HISTORY_DEPTH", 5),
+		AvatarDeleteGrace:   time.Duration(getEnvNonNegativeInt("AVATAR_DELETE_GRACE_SECONDS", 7*24*3600)) * time.Second,
+		AvatarPurgeInterval: time.Duration(getEnvPositiveInt("AVATAR_PURGE_INTERVAL_SECONDS", 3600)) * time.Second,
+
+		UserEventsSecret: getEnv("USER_EVENTS_SECRET", ""),
 	}
 }
 
@@ -35,4 +129,64 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
 
+// getEnvPositiveInt как getEnvInt, но нулевые и отрицательные значения заменяет на defaultValue
+func getEnvPositiveInt(key string, defaultValue int) int {
+	if value := getEnvInt(key, defaultValue); value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvNonNegativeInt как getEnvInt, но отрицательные значения заменяет на defaultValue
+func getEnvNonNegativeInt(key string, defaultValue int) int {
+	if value := getEnvInt(key, defaultValue); value >= 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList разбирает список значений через запятую
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap разбирает список пар key=value через запятую
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+
+	result := make(map[string]string, len(items))
+	for _, item := range items {
+		if name, value, ok := strings.Cut(item, "="); ok {
+			result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return result
+}
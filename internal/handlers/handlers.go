@@ -1,35 +1,51 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	"github.com/S0rgi/Gainly_Avatars/internal/metrics"
 	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
 	"github.com/S0rgi/Gainly_Avatars/internal/services"
 )
 
 type Handlers struct {
 	avatarService *services.AvatarService
+	maxBatchSize  int
 }
 
-func NewHandlers(avatarService *services.AvatarService) *Handlers {
+func NewHandlers(avatarService *services.AvatarService, maxBatchSize int) *Handlers {
 	return &Handlers{
 		avatarService: avatarService,
+		maxBatchSize:  maxBatchSize,
 	}
 }
 
 // AddAvatar обрабатывает загрузку аватарки
 // @Summary Загрузить аватарку
-// @Description Загружает новую аватарку для текущего пользователя
+// @Description Загружает новую аватарку для текущего пользователя. Допустимые форматы: JPEG, PNG, WebP, GIF (определяются по содержимому файла). Изображение обрезается до квадрата: по заданной области, вокруг точки фокуса или по центру
 // @Tags avatars
 // @Accept multipart/form-data
 // @Produce json
 // @Param avatar formData file true "Файл аватарки"
+// @Param crop_x formData int false "Левый край области обрезки в пикселях"
+// @Param crop_y formData int false "Верхний край области обрезки в пикселях"
+// @Param crop_width formData int false "Ширина области обрезки в пикселях"
+// @Param crop_height formData int false "Высота области обрезки в пикселях"
+// @Param focal_x formData number false "Точка фокуса по горизонтали (0..1), если область не задана"
+// @Param focal_y formData number false "Точка фокуса по вертикали (0..1), если область не задана"
 // @Success 200 {object} map[string]string "GUID загруженной аватарки"
 // @Failure 400 {object} map[string]string "Ошибка валидации"
 // @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 415 {object} map[string]string "Неподдерживаемый формат"
+// @Failure 422 {object} map[string]string "Поврежденное изображение или недопустимые размеры"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Security BearerAuth
 // @Router /avatar [post]
@@ -56,26 +72,23 @@ func (h *Handlers) AddAvatar(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Получаем размер файла
-	fileSize := handler.Size
-
-	// Получаем content type
-	contentType := handler.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	crop, err := parseCropForm(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Загружаем аватарку
+	// Загружаем аватарку (тип файла определяется сервисом по содержимому)
 	guid, err := h.avatarService.AddAvatar(
 		r.Context(),
+		user.Id,
 		user.Username,
 		file,
 		handler.Filename,
-		contentType,
-		fileSize,
+		services.UploadOptions{Crop: crop},
 	)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, uploadErrorStatus(err), err.Error())
 		return
 	}
 
@@ -87,11 +100,12 @@ func (h *Handlers) AddAvatar(w http.ResponseWriter, r *http.Request) {
 
 // GetAvatar обрабатывает получение аватарки по username
 // @Summary Получить аватарку по username
-// @Description Возвращает URL аватарки указанного пользователя
+// @Description Возвращает URL аватарки указанного пользователя. Если пользователь ничего не загружал или скрыл аватарку от текущего пользователя (видимость friends или private), возвращается сгенерированная аватарка по умолчанию (is_default=true)
 // @Tags avatars
 // @Produce json
 // @Param username query string true "Имя пользователя"
-// @Success 200 {object} map[string]string "URL аватарки"
+// @Param size query int false "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия"
+// @Success 200 {object} services.AvatarURL "URL аватарки"
 // @Failure 400 {object} map[string]string "Ошибка валидации"
 // @Failure 404 {object} map[string]string "Аватарка не найдена"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
@@ -105,31 +119,37 @@ func (h *Handlers) GetAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := h.avatarService.GetMyAvatar(r.Context(), username)
+	size, err := parseSizeParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	avatar, err := h.avatarService.GetAvatarByUsername(r.Context(), viewerFromContext(r), username, size)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"url": url,
-	})
+	respondWithJSON(w, http.StatusOK, avatar)
 }
 
 // GetAvatarsByUsernames обрабатывает получение аватарок по списку username
 // @Summary Получить аватарки по username
-// @Description Возвращает URL аватарок для списка пользователей
+// @Description Возвращает URL аватарок для списка пользователей (не более AVATARS_BATCH_MAX_SIZE за запрос). Для пользователей без загрузки возвращается аватарка по умолчанию (is_default=true). Аутентификация необязательна: без токена аватарки с видимостью friends и private заменяются аватаркой по умолчанию
 // @Tags avatars
 // @Accept json
 // @Produce json
 // @Param request body GetAvatarsRequest true "Список username"
-// @Success 200 {object} map[string]string "Карта username -> URL"
+// @Success 200 {object} map[string]services.AvatarURL "Карта username -> URL"
 // @Failure 400 {object} map[string]string "Ошибка валидации"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
 // @Router /avatars [post]
 func (h *Handlers) GetAvatarsByUsernames(w http.ResponseWriter, r *http.Request) {
 	var request struct {
 		Usernames []string `json:"usernames"`
+		Size      int      `json:"size"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -137,13 +157,12 @@ func (h *Handlers) GetAvatarsByUsernames(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if len(request.Usernames) == 0 {
-		respondWithError(w, http.StatusBadRequest, "Usernames list cannot be empty")
+	if !h.checkBatch(w, "Usernames", len(request.Usernames), request.Size) {
 		return
 	}
 
 	// Получаем аватарки
-	avatars, err := h.avatarService.GetAvatarsByUsernames(r.Context(), request.Usernames)
+	avatars, err := h.avatarService.GetAvatarsByUsernames(r.Context(), viewerFromContext(r), request.Usernames, request.Size)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -154,10 +173,11 @@ func (h *Handlers) GetAvatarsByUsernames(w http.ResponseWriter, r *http.Request)
 
 // GetMyAvatar обрабатывает получение своей аватарки
 // @Summary Получить свою аватарку
-// @Description Возвращает URL аватарки текущего пользователя
+// @Description Возвращает URL аватарки текущего пользователя или аватарку по умолчанию (is_default=true)
 // @Tags avatars
 // @Produce json
-// @Success 200 {object} map[string]string "URL аватарки"
+// @Param size query int false "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия"
+// @Success 200 {object} services.AvatarURL "URL аватарки"
 // @Failure 401 {object} map[string]string "Не авторизован"
 // @Failure 404 {object} map[string]string "Аватарка не найдена"
 // @Security BearerAuth
@@ -170,21 +190,25 @@ func (h *Handlers) GetMyAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	size, err := parseSizeParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Получаем аватарку
-	url, err := h.avatarService.GetMyAvatar(r.Context(), user.Username)
+	avatar, err := h.avatarService.GetMyAvatar(r.Context(), user.Id, user.Username, size)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"url": url,
-	})
+	respondWithJSON(w, http.StatusOK, avatar)
 }
 
 // DeleteMyAvatar обрабатывает удаление своей аватарки
 // @Summary Удалить свою аватарку
-// @Description Удаляет аватарку текущего пользователя
+// @Description Удаляет аватарку текущего пользователя. Аватарка сразу перестает отдаваться, но хранится AVATAR_DELETE_GRACE_SECONDS и может быть восстановлена через /avatar/me/restore
 // @Tags avatars
 // @Success 204 "Аватарка успешно удалена"
 // @Failure 401 {object} map[string]string "Не авторизован"
@@ -201,7 +225,7 @@ func (h *Handlers) DeleteMyAvatar(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Удаляем аватарку
-	err := h.avatarService.DeleteMyAvatar(r.Context(), user.Username)
+	err := h.avatarService.DeleteMyAvatar(r.Context(), user.Id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -210,17 +234,51 @@ func (h *Handlers) DeleteMyAvatar(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreMyAvatar восстанавливает удаленную аватарку
+// @Summary Восстановить удаленную аватарку
+// @Description Восстанавливает последнюю удаленную аватарку текущего пользователя, если срок восстановления не истек. Загруженная после удаления аватарка переносится в историю
+// @Tags avatars
+// @Produce json
+// @Success 200 {object} map[string]string "GUID восстановленной аватарки"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Нет удаленной аватарки или срок восстановления истек"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/me/restore [post]
+func (h *Handlers) RestoreMyAvatar(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	guid, err := h.avatarService.RestoreDeletedAvatar(r.Context(), user.Id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, clients.ErrDeletedAvatarNotFound) {
+			status = http.StatusNotFound
+		}
+		respondWithError(w, status, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+}
+
 // UploadAvatarFromURL загружает аватарку по URL (например Telegram)
 // @Summary Загрузить аватарку по URL
-// @Description Загружает аватарку из внешнего URL (например Telegram File API)
+// @Description Загружает аватарку из внешнего URL (например Telegram File API). Разрешены только схемы и хосты из REMOTE_FETCH_ALLOWED_SCHEMES и REMOTE_FETCH_ALLOWED_HOSTS, адреса локальных сетей запрещены
 // @Tags avatars
 // @Accept json
 // @Produce json
 // @Param request body UploadAvatarFromURLRequest true "URL изображения"
 // @Success 200 {object} map[string]string "GUID загруженной аватарки"
-// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 400 {object} map[string]string "Ошибка валидации, запрещенный URL или ошибка загрузки файла"
 // @Failure 401 {object} map[string]string "Не авторизован"
-// @Failure 500 {object} map[string]string "Ошибка загрузки или хранения"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 415 {object} map[string]string "Неподдерживаемый формат"
+// @Failure 422 {object} map[string]string "Поврежденное изображение или недопустимые размеры"
+// @Failure 500 {object} map[string]string "Ошибка хранения"
 // @Security BearerAuth
 // @Router /avatar/url [post]
 func (h *Handlers) UploadAvatarFromURL(w http.ResponseWriter, r *http.Request) {
@@ -241,68 +299,184 @@ func (h *Handlers) UploadAvatarFromURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Загружаем файл
-	resp, err := http.Get(req.URL)
+	// Сервис загружает файл с защитой от SSRF и определяет тип по содержимому
+	guid, err := h.avatarService.AddAvatarFromURL(
+		r.Context(),
+		user.Id,
+		user.Username,
+		req.URL,
+		services.UploadOptions{Crop: imaging.Crop{Rect: req.Crop, Focal: req.Focal}},
+	)
+
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to download file")
+		respondWithError(w, uploadErrorStatus(err), err.Error())
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respondWithError(w, http.StatusBadRequest, "Remote server returned error")
+	respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+}
+
+// CreateUploadURL выдает ссылку для загрузки аватарки напрямую в хранилище
+// @Summary Получить ссылку для прямой загрузки
+// @Description Возвращает presigned PUT URL. Клиент загружает файл по ссылке с указанным Content-Type и точным размером, затем вызывает /avatar/complete. Ссылка действует 15 минут
+// @Tags avatars
+// @Accept json
+// @Produce json
+// @Param request body CreateUploadURLRequest true "Content-Type и размер файла"
+// @Success 200 {object} services.UploadURL "Ссылка для загрузки"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 415 {object} map[string]string "Неподдерживаемый формат"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/upload-url [post]
+func (h *Handlers) CreateUploadURL(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
-	// Определяем content-type
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	var req CreateUploadURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
 	}
 
-	// Определяем длину (если Telegram не даёт — читаем вручную)
-	contentLength := resp.ContentLength
-	if contentLength <= 0 {
-		// Чтение в память для получения размера
-		fileData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Failed to read file")
-			return
-		}
+	upload, err := h.avatarService.CreateUploadURL(r.Context(), user.Id, user.Username, req.ContentType, req.Size)
+	if err != nil {
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
 
-		contentLength = int64(len(fileData))
-		fileReader := io.NopCloser(bytes.NewReader(fileData))
+	respondWithJSON(w, http.StatusOK, upload)
+}
 
-		guid, err := h.avatarService.AddAvatar(
-			r.Context(),
-			user.Username,
-			fileReader,
-			"avatar.jpg", // или req.URL basename?
-			contentType,
-			contentLength,
-		)
+// CompleteUpload завершает прямую загрузку
+// @Summary Завершить прямую загрузку
+// @Description Проверяет загруженный по ссылке файл (размер, Content-Type, содержимое) и сохраняет его как аватарку
+// @Tags avatars
+// @Accept json
+// @Produce json
+// @Param request body CompleteUploadRequest true "ID загрузки"
+// @Success 200 {object} map[string]string "GUID загруженной аватарки"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Загрузка не найдена"
+// @Failure 409 {object} map[string]string "Файл еще не загружен"
+// @Failure 410 {object} map[string]string "Ссылка для загрузки истекла"
+// @Failure 415 {object} map[string]string "Неподдерживаемый формат"
+// @Failure 422 {object} map[string]string "Файл не совпадает с заявленным или поврежден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/complete [post]
+func (h *Handlers) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
 
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
+	var req CompleteUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
 
-		respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+	if req.UploadID == "" {
+		respondWithError(w, http.StatusBadRequest, "upload_id is required")
 		return
 	}
 
-	// Если Content-Length есть — передаем поток напрямую
-	guid, err := h.avatarService.AddAvatar(
+	guid, err := h.avatarService.CompleteUpload(
 		r.Context(),
+		user.Id,
 		user.Username,
-		resp.Body,
-		"avatar.jpg", // filename можно извлечь из URL
-		contentType,
-		contentLength,
+		req.UploadID,
+		services.UploadOptions{Crop: imaging.Crop{Rect: req.Crop, Focal: req.Focal}},
 	)
+	if err != nil {
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
 
+	respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+}
+
+// ImportGravatar импортирует Gravatar по email текущего пользователя
+// @Summary Импортировать аватарку из Gravatar
+// @Description Загружает Gravatar, привязанный к email пользователя (SHA-256 или MD5 хэш согласно GRAVATAR_HASH)
+// @Tags avatars
+// @Produce json
+// @Success 200 {object} map[string]string "GUID загруженной аватарки"
+// @Failure 400 {object} map[string]string "У пользователя нет email или ошибка загрузки"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Gravatar не найден"
+// @Failure 422 {object} map[string]string "Поврежденное изображение или недопустимые размеры"
+// @Failure 503 {object} map[string]string "Импорт из Gravatar отключен"
+// @Security BearerAuth
+// @Router /avatar/import/gravatar [post]
+func (h *Handlers) ImportGravatar(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	guid, err := h.avatarService.ImportGravatar(r.Context(), user.Id, user.Username, user.Email, services.UploadOptions{})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+}
+
+// ImportOAuthAvatar импортирует картинку профиля OAuth провайдера
+// @Summary Импортировать аватарку OAuth провайдера
+// @Description Загружает картинку профиля (например picture из Google userinfo). URL должен находиться под базовым URL провайдера из OAUTH_AVATAR_PROVIDERS
+// @Tags avatars
+// @Accept json
+// @Produce json
+// @Param request body ImportOAuthAvatarRequest true "Провайдер и URL картинки"
+// @Success 200 {object} map[string]string "GUID загруженной аватарки"
+// @Failure 400 {object} map[string]string "Неизвестный провайдер, чужой URL или ошибка загрузки"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 415 {object} map[string]string "Неподдерживаемый формат"
+// @Failure 422 {object} map[string]string "Поврежденное изображение или недопустимые размеры"
+// @Failure 503 {object} map[string]string "Импорт OAuth аватарок не настроен"
+// @Security BearerAuth
+// @Router /avatar/import/oauth [post]
+func (h *Handlers) ImportOAuthAvatar(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	var req ImportOAuthAvatarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if req.Provider == "" || req.PictureURL == "" {
+		respondWithError(w, http.StatusBadRequest, "provider and picture_url are required")
+		return
+	}
+
+	guid, err := h.avatarService.ImportOAuthAvatar(
+		r.Context(),
+		user.Id,
+		user.Username,
+		req.Provider,
+		req.PictureURL,
+		services.UploadOptions{Crop: imaging.Crop{Rect: req.Crop, Focal: req.Focal}},
+	)
+	if err != nil {
+		respondWithError(w, uploadErrorStatus(err), err.Error())
 		return
 	}
 
@@ -313,16 +487,186 @@ func (h *Handlers) UploadAvatarFromURL(w http.ResponseWriter, r *http.Request) {
 
 type UploadAvatarFromURLRequest struct {
 	URL string `json:"url" example:"https://t.me/i/userpic/..."`
+	// Crop область обрезки в пикселях исходного изображения
+	Crop *imaging.CropRect `json:"crop,omitempty"`
+	// Focal точка фокуса (доли 0..1), если область не задана
+	Focal *imaging.FocalPoint `json:"focal,omitempty"`
+}
+
+type ImportTelegramAvatarRequest struct {
+	UserID         string `json:"user_id" example:"42"`
+	Username       string `json:"username" example:"john_doe"`
+	TelegramUserID int64  `json:"telegram_user_id" example:"123456789"`
+	// Crop область обрезки в пикселях исходного изображения
+	Crop *imaging.CropRect `json:"crop,omitempty"`
+	// Focal точка фокуса (доли 0..1), если область не задана
+	Focal *imaging.FocalPoint `json:"focal,omitempty"`
+}
+
+type ImportOAuthAvatarRequest struct {
+	Provider   string `json:"provider" example:"google"`
+	PictureURL string `json:"picture_url" example:"https://lh3.googleusercontent.com/a/..."`
+	// Crop область обрезки в пикселях исходного изображения
+	Crop *imaging.CropRect `json:"crop,omitempty"`
+	// Focal точка фокуса (доли 0..1), если область не задана
+	Focal *imaging.FocalPoint `json:"focal,omitempty"`
+}
+
+type CreateUploadURLRequest struct {
+	ContentType string `json:"content_type" example:"image/jpeg"`
+	Size        int64  `json:"size" example:"524288"`
+}
+
+type CompleteUploadRequest struct {
+	UploadID string `json:"upload_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	// Crop область обрезки в пикселях исходного изображения
+	Crop *imaging.CropRect `json:"crop,omitempty"`
+	// Focal точка фокуса (доли 0..1), если область не задана
+	Focal *imaging.FocalPoint `json:"focal,omitempty"`
+}
+
+type SetAvatarVisibilityRequest struct {
+	Visibility string `json:"visibility" example:"friends" enums:"public,friends,private"`
 }
 
 type GetAvatarsRequest struct {
 	Usernames []string `json:"usernames" example:"user1,user2"`
+	Size      int      `json:"size,omitempty" example:"128"`
+}
+
+type RenameUserRequest struct {
+	UserID   string `json:"user_id" example:"42"`
+	Username string `json:"username" example:"new_username"`
+}
+
+type GetAvatarsByIDsRequest struct {
+	IDs  []string `json:"ids" example:"42,43"`
+	Size int      `json:"size,omitempty" example:"128"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error" example:"error message"`
 }
 
+// checkBatch проверяет размер пакетного запроса (what - название списка в ошибках)
+// и учитывает его в метриках. При ошибке отвечает 400 и возвращает false
+func (h *Handlers) checkBatch(w http.ResponseWriter, what string, count, size int) bool {
+	if count == 0 {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s list cannot be empty", what))
+		return false
+	}
+
+	if count > h.maxBatchSize {
+		metrics.BatchRejected()
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Too many %s: maximum is %d", strings.ToLower(what), h.maxBatchSize))
+		return false
+	}
+
+	if size < 0 {
+		respondWithError(w, http.StatusBadRequest, "size must be a positive integer")
+		return false
+	}
+
+	metrics.ObserveBatchSize(count)
+	return true
+}
+
+// parseSizeParam разбирает необязательный параметр size (0 - оригинал)
+func parseSizeParam(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("size")
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("size must be a positive integer")
+	}
+	return size, nil
+}
+
+// parseCropForm разбирает необязательные поля обрезки multipart формы:
+// crop_x, crop_y, crop_width, crop_height или focal_x, focal_y
+func parseCropForm(r *http.Request) (imaging.Crop, error) {
+	return parseCrop(r.FormValue)
+}
+
+// parseCrop разбирает параметры обрезки, получая значения полей через value
+func parseCrop(value func(string) string) (imaging.Crop, error) {
+	var crop imaging.Crop
+
+	rectFields := []string{"crop_x", "crop_y", "crop_width", "crop_height"}
+	var rect [4]int
+	var rectSet int
+	for i, field := range rectFields {
+		v := value(field)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return crop, fmt.Errorf("%s must be an integer", field)
+		}
+		rect[i] = n
+		rectSet++
+	}
+	switch rectSet {
+	case 0:
+	case len(rectFields):
+		crop.Rect = &imaging.CropRect{X: rect[0], Y: rect[1], Width: rect[2], Height: rect[3]}
+	default:
+		return crop, fmt.Errorf("crop_x, crop_y, crop_width and crop_height must be specified together")
+	}
+
+	focalX, focalY := value("focal_x"), value("focal_y")
+	if focalX == "" && focalY == "" {
+		return crop, nil
+	}
+	if focalX == "" || focalY == "" {
+		return crop, fmt.Errorf("focal_x and focal_y must be specified together")
+	}
+	x, errX := strconv.ParseFloat(focalX, 64)
+	y, errY := strconv.ParseFloat(focalY, 64)
+	if errX != nil || errY != nil {
+		return crop, fmt.Errorf("focal_x and focal_y must be numbers")
+	}
+	crop.Focal = &imaging.FocalPoint{X: x, Y: y}
+
+	return crop, nil
+}
+
+// uploadErrorStatus возвращает HTTP статус для ошибки загрузки аватарки
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAvatarTooLarge), errors.Is(err, clients.ErrRemoteFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, clients.ErrRemoteFetchForbidden), errors.Is(err, clients.ErrRemoteFetchFailed),
+		errors.Is(err, clients.ErrUnknownOAuthProvider), errors.Is(err, services.ErrNoEmail):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidUploadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, clients.ErrTelegramNoPhoto), errors.Is(err, clients.ErrGravatarNotFound),
+		errors.Is(err, clients.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUploadIncomplete), errors.Is(err, services.ErrUploadOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrUploadExpired):
+		return http.StatusGone
+	case errors.Is(err, services.ErrUploadMismatch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, clients.ErrTelegramAPI):
+		return http.StatusBadGateway
+	case errors.Is(err, services.ErrImportNotConfigured):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, imaging.ErrInvalidImage), errors.Is(err, imaging.ErrInvalidCrop):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
+	"github.com/S0rgi/Gainly_Avatars/internal/services"
+	pb "github.com/S0rgi/Gainly_Avatars/pkg/proto"
+	"github.com/gorilla/mux"
+)
+
+// testServiceSecret общий секрет маршрутов /internal в тестах
+const testServiceSecret = "service-secret"
+
+// fakeUserService принимает токены "token-<id>" пользователей из users
+type fakeUserService struct {
+	users map[string]string
+}
+
+func (f fakeUserService) ValidateToken(ctx context.Context, token string) (*pb.UserResponse, error) {
+	id := strings.TrimPrefix(token, "token-")
+	username, ok := f.users[id]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return &pb.UserResponse{Id: id, Username: username}, nil
+}
+
+func (f fakeUserService) GetUserById(ctx context.Context, userId string) (*pb.UserResponse, error) {
+	username, ok := f.users[userId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", clients.ErrUserNotFound, userId)
+	}
+	return &pb.UserResponse{Id: userId, Username: username}, nil
+}
+
+func (f fakeUserService) CheckFriendship(ctx context.Context, userId, friendName string) (*pb.FriendshipResponse, error) {
+	return nil, clients.ErrNotFriends
+}
+
+func (f fakeUserService) Close() error {
+	return nil
+}
+
+// newTestRouter собирает маршруты как cmd/server на хранилищах в памяти
+func newTestRouter(t *testing.T, retention services.RetentionOptions, importers services.Importers) http.Handler {
+	t.Helper()
+
+	encoder, err := imaging.NewEncoder("jpeg", 85, 80)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	users := fakeUserService{users: map[string]string{"1": "alice", "2": "bob"}}
+	service := services.NewAvatarService(clients.NewMemoryStorage(), clients.NewMemoryMetadataStore(), encoder,
+		imaging.PlaceholderNone, nil, importers, services.URLOptions{}, retention, users)
+	h := NewHandlers(service, 10)
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(middleware.AuthMiddleware(users))
+	api.Use(h.SyncUsername)
+	api.HandleFunc("/avatar", h.AddAvatar).Methods("POST")
+	api.HandleFunc("/avatars", h.GetAvatarsByUsernames).Methods("POST")
+	api.HandleFunc("/avatar/by-id/{id}", h.GetAvatarByUserID).Methods("GET")
+	api.HandleFunc("/avatars/by-id", h.GetAvatarsByUserIDs).Methods("POST")
+	api.HandleFunc("/avatar/me", h.GetMyAvatar).Methods("GET")
+	api.HandleFunc("/avatar/me", h.DeleteMyAvatar).Methods("DELETE")
+	api.HandleFunc("/avatar/me/restore", h.RestoreMyAvatar).Methods("POST")
+	api.HandleFunc("/avatar/me/visibility", h.SetAvatarVisibility).Methods("PUT")
+	api.HandleFunc("/avatar/history", h.GetAvatarHistory).Methods("GET")
+	api.HandleFunc("/avatar/history/{guid}/restore", h.RestoreAvatarVersion).Methods("POST")
+
+	events := router.PathPrefix("/internal").Subrouter()
+	events.Use(middleware.ServiceAuthMiddleware(testServiceSecret))
+	events.HandleFunc("/users/rename", h.RenameUser).Methods("POST")
+	events.HandleFunc("/users/import/telegram", h.ImportTelegramAvatar).Methods("POST")
+	return router
+}
+
+// testPNG возвращает PNG 64x64 одного цвета
+func testPNG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// do выполняет запрос; token - токен пользователя или секрет сервиса, body - JSON
+func do(t *testing.T, router http.Handler, method, target, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// upload загружает изображение от имени пользователя и возвращает GUID аватарки
+func upload(t *testing.T, router http.Handler, token string, data []byte) string {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/avatar", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /api/avatar = %d %s", rec.Code, rec.Body.String())
+	}
+	return decode[map[string]string](t, rec)["guid"]
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var value T
+	if err := json.NewDecoder(rec.Body).Decode(&value); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return value
+}
+
+func TestVisibilityAndBatchRoutes(t *testing.T) {
+	router := newTestRouter(t, services.RetentionOptions{}, services.Importers{})
+	upload(t, router, "token-1", testPNG(t, color.RGBA{R: 255, A: 255}))
+
+	if rec := do(t, router, http.MethodPut, "/api/avatar/me/visibility", "token-1", map[string]string{"visibility": "hidden"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT visibility hidden = %d, want 400", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPut, "/api/avatar/me/visibility", "token-2", map[string]string{"visibility": "private"}); rec.Code != http.StatusNotFound {
+		t.Fatalf("PUT visibility without avatar = %d, want 404", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPut, "/api/avatar/me/visibility", "token-1", map[string]string{"visibility": "private"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT visibility private = %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Приватная аватарка видна только владельцу; истекший токен не ломает пакетный запрос
+	for _, tt := range []struct {
+		target string
+		body   any
+		key    string
+	}{
+		{"/api/avatars", map[string]any{"usernames": []string{"alice"}}, "alice"},
+		{"/api/avatars/by-id", map[string]any{"ids": []string{"1"}}, "1"},
+	} {
+		for token, visible := range map[string]bool{"": false, "expired": false, "token-2": false, "token-1": true} {
+			rec := do(t, router, http.MethodPost, tt.target, token, tt.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("POST %s with token %q = %d %s", tt.target, token, rec.Code, rec.Body.String())
+			}
+			avatars := decode[map[string]services.AvatarURL](t, rec)
+			if avatar, ok := avatars[tt.key]; (ok && !avatar.IsDefault) != visible {
+				t.Errorf("POST %s with token %q = %v, visible want %v", tt.target, token, avatars, visible)
+			}
+		}
+	}
+
+	if rec := do(t, router, http.MethodPost, "/api/avatars/by-id", "", map[string]any{"ids": []string{}}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("POST /api/avatars/by-id with empty ids = %d, want 400", rec.Code)
+	}
+	if rec := do(t, router, http.MethodGet, "/api/avatar/by-id/1", "token-1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/avatar/by-id/1 = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, router, http.MethodGet, "/api/avatar/by-id/3", "token-1", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET /api/avatar/by-id/3 = %d, want 404", rec.Code)
+	}
+}
+
+func TestHistoryRoutes(t *testing.T) {
+	router := newTestRouter(t, services.RetentionOptions{HistoryDepth: 2}, services.Importers{})
+	first := upload(t, router, "token-1", testPNG(t, color.RGBA{R: 255, A: 255}))
+	upload(t, router, "token-1", testPNG(t, color.RGBA{B: 255, A: 255}))
+
+	rec := do(t, router, http.MethodGet, "/api/avatar/history", "token-1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/avatar/history = %d %s", rec.Code, rec.Body.String())
+	}
+	if versions := decode[[]services.AvatarVersion](t, rec); len(versions) != 1 || versions[0].GUID != first {
+		t.Fatalf("history = %+v, want [%s]", versions, first)
+	}
+
+	// Чужую или неизвестную версию восстановить нельзя
+	if rec := do(t, router, http.MethodPost, "/api/avatar/history/"+first+"/restore", "token-2", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("restore foreign version = %d, want 404", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPost, "/api/avatar/history/"+first+"/restore", "token-1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("restore version = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = do(t, router, http.MethodPost, "/api/avatars/by-id", "", map[string]any{"ids": []string{"1"}})
+	if avatars := decode[map[string]services.AvatarURL](t, rec); avatars["1"].URL == "" {
+		t.Fatalf("avatars after restore = %v", avatars)
+	}
+}
+
+func TestDeleteAndRestoreRoutes(t *testing.T) {
+	router := newTestRouter(t, services.RetentionOptions{DeleteGrace: time.Hour}, services.Importers{})
+	guid := upload(t, router, "token-1", testPNG(t, color.RGBA{R: 255, A: 255}))
+
+	if rec := do(t, router, http.MethodPost, "/api/avatar/me/restore", "token-1", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("restore without deletion = %d, want 404", rec.Code)
+	}
+	if rec := do(t, router, http.MethodDelete, "/api/avatar/me", "token-1", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /api/avatar/me = %d %s", rec.Code, rec.Body.String())
+	}
+	rec := do(t, router, http.MethodPost, "/api/avatars", "", map[string]any{"usernames": []string{"alice"}})
+	if avatars := decode[map[string]services.AvatarURL](t, rec); len(avatars) != 0 {
+		t.Fatalf("avatars after delete = %v, want none", avatars)
+	}
+
+	rec = do(t, router, http.MethodPost, "/api/avatar/me/restore", "token-1", nil)
+	if rec.Code != http.StatusOK || decode[map[string]string](t, rec)["guid"] != guid {
+		t.Fatalf("restore = %d, want 200 with guid %s", rec.Code, guid)
+	}
+	if rec := do(t, router, http.MethodPost, "/api/avatar/me/restore", "token-1", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("second restore = %d, want 404", rec.Code)
+	}
+}
+
+func TestRenameRoute(t *testing.T) {
+	router := newTestRouter(t, services.RetentionOptions{}, services.Importers{})
+	upload(t, router, "token-1", testPNG(t, color.RGBA{R: 255, A: 255}))
+
+	rename := map[string]string{"user_id": "1", "username": "alice2"}
+	if rec := do(t, router, http.MethodPost, "/internal/users/rename", "token-1", rename); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("rename with user token = %d, want 401", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPost, "/internal/users/rename", testServiceSecret, map[string]string{"user_id": "1"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("rename without username = %d, want 400", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPost, "/internal/users/rename", testServiceSecret, rename); rec.Code != http.StatusNoContent {
+		t.Fatalf("rename = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(t, router, http.MethodPost, "/api/avatars", "", map[string]any{"usernames": []string{"alice", "alice2"}})
+	if avatars := decode[map[string]services.AvatarURL](t, rec); len(avatars) != 1 || avatars["alice2"].URL == "" {
+		t.Fatalf("avatars after rename = %v, want only alice2", avatars)
+	}
+}
+
+func TestImportTelegramRoute(t *testing.T) {
+	photo := testPNG(t, color.RGBA{G: 255, A: 255})
+	// Заглушка Bot API: фото профиля есть только у пользователя Telegram 777
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getUserProfilePhotos"):
+			photos := `[]`
+			if r.URL.Query().Get("user_id") == "777" {
+				photos = `[[{"file_id":"f1","width":64,"height":64}]]`
+			}
+			fmt.Fprintf(w, `{"ok":true,"result":{"total_count":1,"photos":%s}}`, photos)
+		case strings.HasSuffix(r.URL.Path, "/getFile"):
+			fmt.Fprint(w, `{"ok":true,"result":{"file_id":"f1","file_path":"photos/f1.png"}}`)
+		case strings.HasSuffix(r.URL.Path, "/photos/f1.png"):
+			w.Write(photo)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer bot.Close()
+
+	importers := services.Importers{Telegram: clients.NewTelegramClient(bot.URL, "bot-token", 5*time.Second, services.MaxAvatarSize)}
+	router := newTestRouter(t, services.RetentionOptions{}, importers)
+
+	request := map[string]any{"user_id": "1", "username": "alice", "telegram_user_id": 777}
+	// Пользователь не может импортировать фото сам, указав произвольный Telegram ID
+	if rec := do(t, router, http.MethodPost, "/internal/users/import/telegram", "token-1", request); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("import with user token = %d, want 401", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPost, "/internal/users/import/telegram", testServiceSecret, map[string]any{"user_id": "1", "username": "alice"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("import without telegram_user_id = %d, want 400", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPost, "/internal/users/import/telegram", testServiceSecret, map[string]any{"user_id": "2", "username": "bob", "telegram_user_id": 778}); rec.Code != http.StatusNotFound {
+		t.Fatalf("import without photo = %d, want 404", rec.Code)
+	}
+	if rec := do(t, router, http.MethodPost, "/internal/users/import/telegram", testServiceSecret, request); rec.Code != http.StatusOK {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(t, router, http.MethodPost, "/api/avatars/by-id", "", map[string]any{"ids": []string{"1", "2"}})
+	if avatars := decode[map[string]services.AvatarURL](t, rec); len(avatars) != 1 || avatars["1"].URL == "" {
+		t.Fatalf("avatars after import = %v, want only user 1", avatars)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
+	"github.com/S0rgi/Gainly_Avatars/internal/services"
+	"github.com/gorilla/mux"
+)
+
+// GetAvatarHistory возвращает предыдущие аватарки текущего пользователя
+// @Summary История аватарок
+// @Description Возвращает предыдущие аватарки текущего пользователя, начиная с последней. Количество хранимых аватарок задается AVATAR_HISTORY_DEPTH
+// @Tags avatars
+// @Produce json
+// @Param size query int false "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия"
+// @Success 200 {array} services.AvatarVersion "Предыдущие аватарки"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/history [get]
+func (h *Handlers) GetAvatarHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	size, err := parseSizeParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	versions, err := h.avatarService.ListAvatarHistory(r.Context(), user.Id, size)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, versions)
+}
+
+// RestoreAvatarVersion делает аватарку из истории текущей
+// @Summary Восстановить предыдущую аватарку
+// @Description Делает аватарку из истории текущей. Текущая аватарка переносится в историю
+// @Tags avatars
+// @Produce json
+// @Param guid path string true "GUID аватарки из истории"
+// @Success 200 {object} map[string]string "GUID восстановленной аватарки"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Аватарки нет в истории"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/history/{guid}/restore [post]
+func (h *Handlers) RestoreAvatarVersion(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	guid := mux.Vars(r)["guid"]
+	if err := h.avatarService.RestoreAvatarVersion(r.Context(), user.Id, guid); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrVersionNotFound) {
+			status = http.StatusNotFound
+		}
+		respondWithError(w, status, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/services"
+	"github.com/gorilla/mux"
+)
+
+// avatarProxyCacheControl Cache-Control ответов с содержимым аватарки. Адрес
+// /avatars/{username} не меняется при смене аватарки, поэтому срок короткий,
+// дальше клиент перепроверяет кэш по ETag и получает 304
+const avatarProxyCacheControl = "public, max-age=300"
+
+// avatarSignedCacheControl Cache-Control ответов по ссылке, подписанной для
+// пользователя: аватарка видна не всем, поэтому не кэшируется общими кэшами,
+// а срок короткий, чтобы скрытая аватарка быстро перестала отдаваться
+const avatarSignedCacheControl = "private, max-age=60"
+
+// avatarRedirectCacheControl Cache-Control перенаправления /u/{username}.jpg.
+// Срок заметно меньше срока действия presigned ссылки, чтобы из кэша
+// не отдавалось перенаправление на истекшую ссылку
+const avatarRedirectCacheControl = "public, max-age=60"
+
+// ServeAvatar отдает содержимое аватарки по username без промежуточной ссылки,
+// поэтому адрес можно использовать напрямую в <img src>.
+// GET/HEAD /avatars/{username} и /avatars/{username}/{size}, без аутентификации.
+// Параметр v, совпадающий с текущим объектом, разрешает бессрочное кэширование.
+// Ссылки на аватарки friends и private подписаны для пользователя (viewer,
+// expires, signature): аватарка отдается так, будто ее запросил он.
+// Поддерживаются Range, If-None-Match и If-Modified-Since (http.ServeContent).
+// Маршрут вне /api, поэтому не описан в Swagger
+func (h *Handlers) ServeAvatar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	username := vars["username"]
+
+	size := 0
+	if value, ok := vars["size"]; ok {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			respondWithError(w, http.StatusBadRequest, "size must be a positive integer")
+			return
+		}
+	}
+
+	// Маршрут без аутентификации: без подписи аватарки friends и private
+	// отдаются как аватарка по умолчанию
+	viewer := services.Viewer{}
+	signed := r.URL.Query().Has("signature")
+	if signed {
+		var err error
+		viewer, err = h.avatarService.SignedURLViewer(username, size, r.URL.Query())
+		if err != nil {
+			respondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	avatar, err := h.avatarService.OpenAvatarByUsername(r.Context(), viewer, username, size)
+	if err != nil {
+		respondWithError(w, avatarObjectErrorStatus(err), err.Error())
+		return
+	}
+	defer avatar.Content.Close()
+
+	if avatar.Info.ContentType != "" {
+		w.Header().Set("Content-Type", avatar.Info.ContentType)
+	}
+	if avatar.Info.ETag != "" {
+		w.Header().Set("ETag", avatar.Info.ETag)
+	}
+	// Ссылка с v текущего объекта (стратегия proxy) не изменится вместе с аватаркой
+	switch {
+	case signed:
+		w.Header().Set("Cache-Control", avatarSignedCacheControl)
+	case r.URL.Query().Get("v") == avatar.ObjectID:
+		w.Header().Set("Cache-Control", clients.ImmutableCacheControl)
+	default:
+		w.Header().Set("Cache-Control", avatarProxyCacheControl)
+	}
+
+	// ServeContent выставляет Content-Length, Last-Modified, Accept-Ranges
+	// и отвечает 304/206/416 по условным заголовкам и Range
+	http.ServeContent(w, r, "", avatar.Info.LastModified, avatar.Content)
+}
+
+// RedirectAvatar перенаправляет стабильный адрес аватарки на ее объект
+// GET/HEAD /u/{username}.jpg?size=128, без аутентификации. Отвечает 302 на ссылку
+// согласно AVATAR_URL_STRATEGY, поэтому адрес можно встраивать в веб и email
+// шаблоны, не зная GUID.
+// Маршрут вне /api, поэтому не описан в Swagger
+func (h *Handlers) RedirectAvatar(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	size, err := parseSizeParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	location, err := h.avatarService.AvatarRedirectURL(r.Context(), services.Viewer{}, username, size)
+	if err != nil {
+		respondWithError(w, avatarObjectErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", avatarRedirectCacheControl)
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// avatarObjectErrorStatus возвращает HTTP статус для ошибки получения аватарки
+func avatarObjectErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, clients.ErrUsernameNotFound), errors.Is(err, clients.ErrMetadataNotFound),
+		errors.Is(err, clients.ErrObjectNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
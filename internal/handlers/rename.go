@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
+	"github.com/S0rgi/Gainly_Avatars/internal/services"
+)
+
+// RenameUser обрабатывает событие смены username от UserService: новый username
+// становится псевдонимом пользователя.
+// POST /internal/users/rename, аутентификация общим секретом USER_EVENTS_SECRET.
+// Маршрут вне /api, поэтому не описан в Swagger
+func (h *Handlers) RenameUser(w http.ResponseWriter, r *http.Request) {
+	var req RenameUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == "" || req.Username == "" {
+		respondWithError(w, http.StatusBadRequest, "user_id and username are required")
+		return
+	}
+
+	if err := h.avatarService.RenameUser(r.Context(), req.UserID, req.Username); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportTelegramAvatar импортирует фото профиля Telegram по привязке, которую
+// подтвердил вызывающий сервис: ни токен, ни UserService не знают Telegram ID пользователя,
+// а доверять ID из запроса пользователя нельзя.
+// POST /internal/users/import/telegram, аутентификация общим секретом USER_EVENTS_SECRET
+func (h *Handlers) ImportTelegramAvatar(w http.ResponseWriter, r *http.Request) {
+	var req ImportTelegramAvatarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == "" || req.Username == "" || req.TelegramUserID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "user_id, username and telegram_user_id are required")
+		return
+	}
+
+	guid, err := h.avatarService.ImportTelegramAvatar(
+		r.Context(),
+		req.UserID,
+		req.Username,
+		req.TelegramUserID,
+		services.UploadOptions{Crop: imaging.Crop{Rect: req.Crop, Focal: req.Focal}},
+	)
+	if err != nil {
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"guid": guid})
+}
+
+// SyncUsername middleware после AuthMiddleware: если username из токена отличается
+// от сохраненного для ID пользователя, псевдоним обновляется до обработки запроса. Ошибки только логируются
+func (h *Handlers) SyncUsername(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+			if err := h.avatarService.SyncUsername(r.Context(), user.Id, user.Username); err != nil {
+				log.Printf("[AVATAR] WARNING: failed to sync username of user %s: %v", user.Id, err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
+	"github.com/S0rgi/Gainly_Avatars/internal/services"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// tusVersion поддерживаемая версия протокола tus
+	tusVersion = "1.0.0"
+	// tusExtensions поддерживаемые расширения протокола
+	tusExtensions = "creation,termination,expiration"
+	// tusRoute путь возобновляемых загрузок; Location загрузки - tusRoute + "/" + ID
+	tusRoute = "/api/avatar/tus"
+	// tusContentType обязательный Content-Type запроса PATCH
+	tusContentType = "application/offset+octet-stream"
+	// avatarGUIDHeader заголовок ответа на последний PATCH с GUID сохраненной аватарки
+	avatarGUIDHeader = "Avatar-Guid"
+)
+
+// TusOptions сообщает о поддерживаемых возможностях tus
+// @Summary Возможности возобновляемой загрузки (tus)
+// @Description Возвращает версию протокола tus, расширения и максимальный размер файла
+// @Tags tus
+// @Success 204 "Tus-Version, Tus-Extension, Tus-Max-Size в заголовках"
+// @Router /avatar/tus [options]
+func (h *Handlers) TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(services.MaxAvatarSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate создает возобновляемую загрузку
+// @Summary Начать возобновляемую загрузку (tus)
+// @Description Создает загрузку размером Upload-Length и возвращает ее адрес в Location. Upload-Metadata (пары "ключ base64", через запятую) может содержать filename и параметры обрезки crop_x, crop_y, crop_width, crop_height или focal_x, focal_y. Незавершенная загрузка удаляется через 24 часа
+// @Tags tus
+// @Param Tus-Resumable header string true "Версия протокола: 1.0.0"
+// @Param Upload-Length header int true "Размер файла в байтах"
+// @Param Upload-Metadata header string false "Метаданные загрузки"
+// @Success 201 "Location, Upload-Expires в заголовках"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 412 {object} map[string]string "Неподдерживаемая версия протокола"
+// @Failure 413 {object} map[string]string "Файл слишком большой"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/tus [post]
+func (h *Handlers) TusCreate(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		respondWithError(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Upload-Length must be an integer")
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	crop, err := parseCrop(func(key string) string { return metadata[key] })
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	upload, err := h.avatarService.CreateResumableUpload(r.Context(), user.Id, user.Username, length, metadata["filename"], rawMetadata, crop)
+	if err != nil {
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Location", tusRoute+"/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHead возвращает состояние возобновляемой загрузки
+// @Summary Состояние возобновляемой загрузки (tus)
+// @Description Возвращает число полученных байт в Upload-Offset, с которого нужно продолжить загрузку
+// @Tags tus
+// @Param id path string true "ID загрузки"
+// @Param Tus-Resumable header string true "Версия протокола: 1.0.0"
+// @Success 200 "Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires в заголовках"
+// @Failure 401 "Не авторизован"
+// @Failure 404 "Загрузка не найдена"
+// @Failure 410 "Загрузка истекла"
+// @Security BearerAuth
+// @Router /avatar/tus/{id} [head]
+func (h *Handlers) TusHead(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+
+	upload, err := h.avatarService.GetResumableUpload(r.Context(), user.Id, mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(uploadErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatch дописывает данные в возобновляемую загрузку
+// @Summary Загрузить часть файла (tus)
+// @Description Дописывает тело запроса с позиции Upload-Offset, которая должна совпадать с текущим смещением загрузки. После получения всего файла он проверяется и сохраняется как аватарка, GUID возвращается в заголовке Avatar-Guid
+// @Tags tus
+// @Accept application/offset+octet-stream
+// @Param id path string true "ID загрузки"
+// @Param Tus-Resumable header string true "Версия протокола: 1.0.0"
+// @Param Upload-Offset header int true "Смещение, с которого передаются данные"
+// @Success 204 "Upload-Offset (и Avatar-Guid после последней части) в заголовках"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Загрузка не найдена"
+// @Failure 409 {object} map[string]string "Смещение не совпадает"
+// @Failure 410 {object} map[string]string "Загрузка истекла"
+// @Failure 412 {object} map[string]string "Неподдерживаемая версия протокола"
+// @Failure 415 {object} map[string]string "Неверный Content-Type или формат файла"
+// @Failure 422 {object} map[string]string "Файл поврежден или неверная обрезка"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/tus/{id} [patch]
+func (h *Handlers) TusPatch(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != tusContentType {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "Upload-Offset must be a non-negative integer")
+		return
+	}
+
+	offset, guid, err := h.avatarService.WriteResumableUpload(r.Context(), user.Id, user.Username, mux.Vars(r)["id"], offset, r.Body)
+	if err != nil {
+		if !errors.Is(err, clients.ErrUploadNotFound) && !errors.Is(err, services.ErrUploadExpired) {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		}
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if guid != "" {
+		w.Header().Set(avatarGUIDHeader, guid)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDelete отменяет возобновляемую загрузку
+// @Summary Отменить возобновляемую загрузку (tus)
+// @Description Удаляет загрузку и все полученные данные
+// @Tags tus
+// @Param id path string true "ID загрузки"
+// @Param Tus-Resumable header string true "Версия протокола: 1.0.0"
+// @Success 204 "Загрузка удалена"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Загрузка не найдена"
+// @Failure 412 {object} map[string]string "Неподдерживаемая версия протокола"
+// @Security BearerAuth
+// @Router /avatar/tus/{id} [delete]
+func (h *Handlers) TusDelete(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	if err := h.avatarService.TerminateResumableUpload(r.Context(), user.Id, mux.Vars(r)["id"]); err != nil {
+		respondWithError(w, uploadErrorStatus(err), err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkTusResumable проверяет версию протокола в Tus-Resumable и выставляет ее в ответе
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "Tus-Resumable must be "+tusVersion)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata разбирает Upload-Metadata: пары "ключ base64(значение)" через запятую,
+// значение может отсутствовать
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata: empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata: value of %q is not base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
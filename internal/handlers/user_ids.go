@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/gorilla/mux"
+)
+
+// GetAvatarByUserID обрабатывает получение аватарки по ID пользователя
+// @Summary Получить аватарку по ID пользователя
+// @Description Возвращает URL аватарки пользователя по Id из UserService, так же как GET /avatar по username. Если пользователь ничего не загружал или скрыл аватарку от текущего пользователя, возвращается аватарка по умолчанию (is_default=true)
+// @Tags avatars
+// @Produce json
+// @Param id path string true "ID пользователя"
+// @Param size query int false "Желаемый размер в пикселях (64, 128, 256, 512); возвращается ближайшая копия"
+// @Success 200 {object} services.AvatarURL "URL аватарки"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 404 {object} map[string]string "Пользователь или аватарка не найдены"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/by-id/{id} [get]
+func (h *Handlers) GetAvatarByUserID(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	size, err := parseSizeParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	avatar, err := h.avatarService.GetAvatarByUserID(r.Context(), viewerFromContext(r), userID, size)
+	if err != nil {
+		status := avatarObjectErrorStatus(err)
+		if errors.Is(err, clients.ErrUserIDNotFound) {
+			status = http.StatusNotFound
+		}
+		respondWithError(w, status, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, avatar)
+}
+
+// GetAvatarsByUserIDs обрабатывает получение аватарок по списку ID пользователей
+// @Summary Получить аватарки по ID пользователей
+// @Description Возвращает URL аватарок для списка ID пользователей из UserService (не более AVATARS_BATCH_MAX_SIZE за запрос), так же как POST /avatars по username. Неизвестные ID пропускаются; в UserService за запрос ищется не больше 10 ID, которых нет в индексе. Аутентификация необязательна: без токена аватарки с видимостью friends и private заменяются аватаркой по умолчанию
+// @Tags avatars
+// @Accept json
+// @Produce json
+// @Param request body GetAvatarsByIDsRequest true "Список ID пользователей"
+// @Success 200 {object} map[string]services.AvatarURL "Карта ID -> URL"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatars/by-id [post]
+func (h *Handlers) GetAvatarsByUserIDs(w http.ResponseWriter, r *http.Request) {
+	var request GetAvatarsByIDsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !h.checkBatch(w, "IDs", len(request.IDs), request.Size) {
+		return
+	}
+
+	avatars, err := h.avatarService.GetAvatarsByUserIDs(r.Context(), viewerFromContext(r), request.IDs, request.Size)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, avatars)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/middleware"
+	"github.com/S0rgi/Gainly_Avatars/internal/services"
+)
+
+// SetAvatarVisibility задает, кому видна аватарка текущего пользователя
+// @Summary Изменить видимость аватарки
+// @Description Задает, кому видна аватарка: public - всем, friends - только друзьям (CheckFriendship), private - только владельцу. Остальным возвращается аватарка по умолчанию. Настройка сохраняется для следующих загрузок
+// @Tags avatars
+// @Accept json
+// @Produce json
+// @Param request body SetAvatarVisibilityRequest true "Видимость"
+// @Success 200 {object} map[string]string "Новая видимость"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Не авторизован"
+// @Failure 404 {object} map[string]string "Аватарка не найдена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Security BearerAuth
+// @Router /avatar/me/visibility [put]
+func (h *Handlers) SetAvatarVisibility(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	var req SetAvatarVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.avatarService.SetAvatarVisibility(r.Context(), user.Id, req.Visibility); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidVisibility):
+			status = http.StatusBadRequest
+		case errors.Is(err, clients.ErrUsernameNotFound), errors.Is(err, clients.ErrMetadataNotFound):
+			status = http.StatusNotFound
+		}
+		respondWithError(w, status, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"visibility": req.Visibility})
+}
+
+// viewerFromContext возвращает пользователя, запрашивающего аватарки.
+// Без аутентификации - анонимный Viewer
+func viewerFromContext(r *http.Request) services.Viewer {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		return services.Viewer{}
+	}
+	return services.Viewer{UserID: user.Id}
+}
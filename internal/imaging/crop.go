@@ -0,0 +1,87 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// ErrInvalidCrop параметры обрезки не подходят к изображению
+var ErrInvalidCrop = errors.New("invalid crop")
+
+// CropRect прямоугольник обрезки в пикселях изображения после применения EXIF ориентации
+type CropRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// FocalPoint точка фокуса в долях ширины и высоты изображения (0..1)
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Crop параметры обрезки. Задается либо Rect, либо Focal;
+// если не задано ничего, вырезается квадрат по центру
+type Crop struct {
+	Rect  *CropRect   `json:"rect,omitempty"`
+	Focal *FocalPoint `json:"focal,omitempty"`
+}
+
+// ResolveSquare вычисляет квадратную область обрезки для изображения width x height.
+// Неквадратный Rect сужается до наибольшего квадрата по его центру,
+// Focal задает центр наибольшего квадрата, помещающегося в изображение
+func (c Crop) ResolveSquare(width, height int) (CropRect, error) {
+	if c.Rect != nil && c.Focal != nil {
+		return CropRect{}, fmt.Errorf("%w: specify either a crop rectangle or a focal point", ErrInvalidCrop)
+	}
+
+	if c.Rect != nil {
+		r := *c.Rect
+		if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 || r.X+r.Width > width || r.Y+r.Height > height {
+			return CropRect{}, fmt.Errorf("%w: rectangle %dx%d at (%d,%d) is outside the %dx%d image",
+				ErrInvalidCrop, r.Width, r.Height, r.X, r.Y, width, height)
+		}
+
+		side := min(r.Width, r.Height)
+		if side < MinDimension {
+			return CropRect{}, fmt.Errorf("%w: crop must be at least %dx%d", ErrInvalidCrop, MinDimension, MinDimension)
+		}
+		return CropRect{
+			X:      r.X + (r.Width-side)/2,
+			Y:      r.Y + (r.Height-side)/2,
+			Width:  side,
+			Height: side,
+		}, nil
+	}
+
+	focalX, focalY := 0.5, 0.5
+	if c.Focal != nil {
+		if c.Focal.X < 0 || c.Focal.X > 1 || c.Focal.Y < 0 || c.Focal.Y > 1 {
+			return CropRect{}, fmt.Errorf("%w: focal point must be within 0..1", ErrInvalidCrop)
+		}
+		focalX, focalY = c.Focal.X, c.Focal.Y
+	}
+
+	side := min(width, height)
+	x := clamp(int(focalX*float64(width))-side/2, 0, width-side)
+	y := clamp(int(focalY*float64(height))-side/2, 0, height-side)
+	return CropRect{X: x, Y: y, Width: side, Height: side}, nil
+}
+
+// CropImage вырезает прямоугольник из изображения
+func CropImage(img image.Image, r CropRect) image.Image {
+	bounds := img.Bounds()
+	rect := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height).Add(bounds.Min)
+
+	dst := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+func clamp(value, low, high int) int {
+	return max(low, min(value, high))
+}
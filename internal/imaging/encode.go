@@ -0,0 +1,71 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/gen2brain/webp"
+)
+
+// Encoder перекодирует изображения в нормализованный формат. Перекодирование
+// отбрасывает все метаданные исходного файла (EXIF, GPS, ICC и т.д.)
+type Encoder struct {
+	Format      Format
+	JPEGQuality int
+	WebPQuality int
+}
+
+// NewEncoder создает Encoder для формата "jpeg" или "webp"
+func NewEncoder(format string, jpegQuality, webpQuality int) (Encoder, error) {
+	switch Format(format) {
+	case FormatJPEG, FormatWebP:
+	default:
+		return Encoder{}, fmt.Errorf("unsupported output format: %s (expected jpeg or webp)", format)
+	}
+
+	if jpegQuality < 1 || jpegQuality > 100 || webpQuality < 1 || webpQuality > 100 {
+		return Encoder{}, fmt.Errorf("image quality must be between 1 and 100")
+	}
+
+	return Encoder{
+		Format:      Format(format),
+		JPEGQuality: jpegQuality,
+		WebPQuality: webpQuality,
+	}, nil
+}
+
+// Encode кодирует изображение в формат Encoder. JPEG не поддерживает прозрачность,
+// поэтому изображения с альфа-каналом в этом случае кодируются в PNG
+func (e Encoder) Encode(img image.Image) ([]byte, Format, error) {
+	var buf bytes.Buffer
+
+	switch {
+	case e.Format == FormatWebP:
+		if err := webp.Encode(&buf, img, webp.Options{Quality: e.WebPQuality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode WebP: %w", err)
+		}
+		return buf.Bytes(), FormatWebP, nil
+
+	case !isOpaque(img):
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode PNG: %w", err)
+		}
+		return buf.Bytes(), FormatPNG, nil
+
+	default:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: e.JPEGQuality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+		return buf.Bytes(), FormatJPEG, nil
+	}
+}
+
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package imaging
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Format формат изображения, определенный по сигнатуре файла
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatWebP Format = "webp"
+)
+
+// MimeType возвращает MIME тип формата
+func (f Format) MimeType() string {
+	return "image/" + string(f)
+}
+
+// FormatFromMimeType возвращает разрешенный формат по MIME типу
+func FormatFromMimeType(mimeType string) (Format, bool) {
+	switch format := Format(strings.TrimPrefix(strings.ToLower(mimeType), "image/")); format {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatWebP:
+		if strings.EqualFold(mimeType, format.MimeType()) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// DetectFormat определяет формат по magic bytes. Возвращает false,
+// если формат не входит в список разрешенных
+func DetectFormat(data []byte) (Format, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF, true
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return FormatWebP, true
+	}
+	return "", false
+}
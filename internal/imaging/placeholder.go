@@ -0,0 +1,180 @@
+package imaging
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// PlaceholderStyle вид аватарки по умолчанию для пользователей без загрузки
+type PlaceholderStyle string
+
+const (
+	// PlaceholderInitials инициалы на цветном фоне
+	PlaceholderInitials PlaceholderStyle = "initials"
+	// PlaceholderIdenticon симметричный геометрический узор 5x5
+	PlaceholderIdenticon PlaceholderStyle = "identicon"
+	// PlaceholderNone аватарки по умолчанию отключены
+	PlaceholderNone PlaceholderStyle = "none"
+)
+
+// ParsePlaceholderStyle проверяет название стиля из конфигурации
+func ParsePlaceholderStyle(value string) (PlaceholderStyle, error) {
+	switch style := PlaceholderStyle(strings.ToLower(value)); style {
+	case PlaceholderInitials, PlaceholderIdenticon, PlaceholderNone:
+		return style, nil
+	default:
+		return "", fmt.Errorf("unsupported default avatar style %q: expected initials, identicon or none", value)
+	}
+}
+
+// placeholderPalette цвета фона, из которых по хэшу выбирается цвет пользователя
+var placeholderPalette = []color.RGBA{
+	{R: 0xE5, G: 0x39, B: 0x35, A: 0xFF},
+	{R: 0xD8, G: 0x1B, B: 0x60, A: 0xFF},
+	{R: 0x8E, G: 0x24, B: 0xAA, A: 0xFF},
+	{R: 0x5E, G: 0x35, B: 0xB1, A: 0xFF},
+	{R: 0x39, G: 0x49, B: 0xAB, A: 0xFF},
+	{R: 0x1E, G: 0x88, B: 0xE5, A: 0xFF},
+	{R: 0x00, G: 0x89, B: 0x7B, A: 0xFF},
+	{R: 0x43, G: 0xA0, B: 0x47, A: 0xFF},
+	{R: 0xF4, G: 0x51, B: 0x1E, A: 0xFF},
+	{R: 0x6D, G: 0x4C, B: 0x41, A: 0xFF},
+	{R: 0x54, G: 0x6E, B: 0x7A, A: 0xFF},
+	{R: 0xC0, G: 0xCA, B: 0x33, A: 0xFF},
+}
+
+var identiconBackground = color.RGBA{R: 0xF0, G: 0xF0, B: 0xF0, A: 0xFF}
+
+// Placeholder детерминированно рисует квадратную аватарку size x size для seed.
+// Для одного seed результат всегда одинаковый
+func Placeholder(style PlaceholderStyle, seed string, size int) (image.Image, error) {
+	switch style {
+	case PlaceholderInitials:
+		return initialsImage(seed, size)
+	case PlaceholderIdenticon:
+		return identiconImage(seed, size), nil
+	default:
+		return nil, fmt.Errorf("unsupported default avatar style %q", style)
+	}
+}
+
+// PlaceholderKey короткий хэш seed для имени закэшированного объекта
+func PlaceholderKey(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+var (
+	boldFontOnce sync.Once
+	boldFont     *opentype.Font
+	boldFontErr  error
+)
+
+func initialsImage(seed string, size int) (image.Image, error) {
+	text := initials(seed)
+
+	boldFontOnce.Do(func() {
+		boldFont, boldFontErr = opentype.Parse(gobold.TTF)
+	})
+	if boldFontErr != nil {
+		return nil, fmt.Errorf("failed to load font: %w", boldFontErr)
+	}
+
+	sum := sha256.Sum256([]byte(seed))
+	background := placeholderPalette[int(sum[0])%len(placeholderPalette)]
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	if text == "" {
+		return img, nil
+	}
+
+	face, err := opentype.NewFace(boldFont, &opentype.FaceOptions{
+		Size:    float64(size) * 0.4,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %w", err)
+	}
+	defer face.Close()
+
+	// Символы, которых нет в шрифте, не рисуются - остается только фон
+	for _, r := range text {
+		if _, ok := face.GlyphAdvance(r); !ok {
+			return img, nil
+		}
+	}
+
+	// Центрируем по фактическим границам глифов
+	drawer := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	bounds, _ := drawer.BoundString(text)
+	width := bounds.Max.X - bounds.Min.X
+	height := bounds.Max.Y - bounds.Min.Y
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(size)-width)/2 - bounds.Min.X,
+		Y: (fixed.I(size)-height)/2 - bounds.Min.Y,
+	}
+	drawer.DrawString(text)
+
+	return img, nil
+}
+
+// initials возвращает до двух заглавных букв: первые буквы частей имени,
+// разделенных пробелом, точкой, дефисом или подчеркиванием
+func initials(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var result []rune
+	for _, part := range parts {
+		result = append(result, unicode.ToUpper([]rune(part)[0]))
+		if len(result) == 2 {
+			break
+		}
+	}
+	return string(result)
+}
+
+// identiconImage рисует узор 5x5, симметричный по вертикальной оси
+func identiconImage(seed string, size int) image.Image {
+	sum := sha256.Sum256([]byte(seed))
+	foreground := placeholderPalette[int(sum[0])%len(placeholderPalette)]
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(identiconBackground), image.Point{}, draw.Src)
+
+	// Сетка 5x5 с полями в половину клетки
+	const cells = 5
+	cell := size / (cells + 1)
+	offset := (size - cell*cells) / 2
+
+	for row := 0; row < cells; row++ {
+		// Заполняем левую половину с центральным столбцом и отражаем ее
+		for col := 0; col < (cells+1)/2; col++ {
+			bit := row*3 + col
+			if sum[1+bit/8]&(1<<(bit%8)) == 0 {
+				continue
+			}
+			for _, c := range []int{col, cells - 1 - col} {
+				rect := image.Rect(offset+c*cell, offset+row*cell, offset+(c+1)*cell, offset+(row+1)*cell)
+				draw.Draw(img, rect, image.NewUniform(foreground), image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return img
+}
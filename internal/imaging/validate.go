@@ -0,0 +1,78 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MinDimension минимальная ширина и высота изображения
+	MinDimension = 16
+	// MaxDimension максимальная ширина и высота изображения
+	MaxDimension = 8192
+	// MaxPixels ограничение на число пикселей (защита от decompression bomb)
+	MaxPixels = 25_000_000
+)
+
+var (
+	// ErrUnsupportedFormat файл не является изображением разрешенного формата
+	ErrUnsupportedFormat = errors.New("unsupported image format: allowed formats are JPEG, PNG, WebP, GIF")
+	// ErrInvalidImage файл поврежден или имеет недопустимые размеры
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// Info сведения о проверенном изображении
+type Info struct {
+	Format Format
+	Width  int
+	Height int
+	// Image декодированное изображение
+	Image image.Image
+}
+
+// MimeType возвращает MIME тип изображения
+func (i *Info) MimeType() string {
+	return i.Format.MimeType()
+}
+
+// Validate определяет формат по сигнатуре, проверяет размеры и декодирует
+// изображение, чтобы убедиться, что файл не поврежден
+func Validate(data []byte) (*Info, error) {
+	format, ok := DetectFormat(data)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Сначала читаем только заголовок, чтобы не декодировать огромные изображения
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if err := checkDimensions(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	return &Info{Format: format, Width: config.Width, Height: config.Height, Image: img}, nil
+}
+
+func checkDimensions(width, height int) error {
+	if width < MinDimension || height < MinDimension {
+		return fmt.Errorf("%w: image is too small (%dx%d, minimum %dx%d)", ErrInvalidImage, width, height, MinDimension, MinDimension)
+	}
+	if width > MaxDimension || height > MaxDimension || width*height > MaxPixels {
+		return fmt.Errorf("%w: image is too large (%dx%d, maximum %dx%d)", ErrInvalidImage, width, height, MaxDimension, MaxDimension)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidate(t *testing.T) {
+	info, err := Validate(encodePNG(t, 32, 24))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if info.Format != FormatPNG || info.Width != 32 || info.Height != 24 || info.Image == nil {
+		t.Fatalf("unexpected info: format=%s size=%dx%d", info.Format, info.Width, info.Height)
+	}
+
+	if _, err := Validate(encodePNG(t, 8, 8)); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("Validate(8x8) error = %v, want ErrInvalidImage", err)
+	}
+	if _, err := Validate([]byte("<html></html>")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Validate(html) error = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestValidateRejectsAVIF(t *testing.T) {
+	// Заголовок ftyp с брендом avif и свойство ispe 64x64, за которыми произвольные данные
+	data := []byte("\x00\x00\x00\x18ftypavif\x00\x00\x00\x00avifmif1")
+	data = append(data, "ispe\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x40<script></script>"...)
+
+	if _, err := Validate(data); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Validate(avif) error = %v, want ErrUnsupportedFormat", err)
+	}
+	if _, ok := FormatFromMimeType("image/avif"); ok {
+		t.Fatalf("image/avif must not be an allowed MIME type")
+	}
+}
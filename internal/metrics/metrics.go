@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Метрики хранятся в переменных expvar и отдаются Handler на /metrics в формате
+// JSON. Переменные не публикуются в expvar: /metrics доступен без аутентификации,
+// а expvar.Handler отдал бы и служебные memstats и cmdline
+
+// batchSizeBuckets верхние границы бакетов гистограммы размера batch-запросов
+var batchSizeBuckets = []int{10, 25, 50, 100, 250}
+
+var (
+	batchRequests     = new(expvar.Int)
+	batchUsernames    = new(expvar.Int)
+	batchRejected     = new(expvar.Int)
+	batchSizeBucketed = new(expvar.Map).Init()
+)
+
+// published метрики, которые отдает Handler, в порядке вывода
+var published = []struct {
+	name string
+	v    expvar.Var
+}{
+	{"avatars_batch_requests_total", batchRequests},
+	{"avatars_batch_usernames_total", batchUsernames},
+	{"avatars_batch_rejected_total", batchRejected},
+	{"avatars_batch_size_bucket", batchSizeBucketed},
+}
+
+// Handler отдает метрики сервиса одним JSON объектом в формате expvar
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, "{\n")
+		for i, metric := range published {
+			if i > 0 {
+				fmt.Fprint(w, ",\n")
+			}
+			fmt.Fprintf(w, "%q: %s", metric.name, metric.v.String())
+		}
+		fmt.Fprint(w, "\n}\n")
+	})
+}
+
+// ObserveBatchSize учитывает размер batch-запроса аватарок
+func ObserveBatchSize(size int) {
+	batchRequests.Add(1)
+	batchUsernames.Add(int64(size))
+
+	for _, bucket := range batchSizeBuckets {
+		if size <= bucket {
+			batchSizeBucketed.Add("le_"+strconv.Itoa(bucket), 1)
+			return
+		}
+	}
+	batchSizeBucketed.Add("le_inf", 1)
+}
+
+// BatchRejected учитывает batch-запрос, отклоненный из-за превышения лимита
+func BatchRejected() {
+	batchRejected.Add(1)
+}
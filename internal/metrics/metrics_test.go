@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerPublishesOnlyServiceMetrics(t *testing.T) {
+	ObserveBatchSize(30)
+	BatchRejected()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, recorder.Body.String())
+	}
+	if len(body) != len(published) {
+		t.Fatalf("published %d metrics, want %d: %s", len(body), len(published), recorder.Body.String())
+	}
+	for _, name := range []string{"memstats", "cmdline"} {
+		if _, ok := body[name]; ok {
+			t.Errorf("%s must not be published", name)
+		}
+	}
+
+	var buckets map[string]int
+	if err := json.Unmarshal(body["avatars_batch_size_bucket"], &buckets); err != nil || buckets["le_50"] != 1 {
+		t.Fatalf("avatars_batch_size_bucket = %s, want le_50: 1", body["avatars_batch_size_bucket"])
+	}
+}
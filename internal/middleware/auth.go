@@ -16,14 +16,29 @@ type contextKey string
 
 const UserContextKey contextKey = "user"
 
+// optionalAuthPaths пути POST запросов, для которых токен необязателен
+var optionalAuthPaths = map[string]bool{
+	"/api/avatars":       true,
+	"/api/avatars/by-id": true,
+}
+
 // AuthMiddleware middleware для аутентификации через gRPC-Web
-// Пропускает запросы к /api/avatars (GetAvatarsByUsernames не требует аутентификации)
+// Для пакетных запросов POST /api/avatars и /api/avatars/by-id аутентификация
+// необязательна: без токена или с недействительным токеном аватарки отдаются анонимно.
+// Пропускает запрос возможностей tus OPTIONS /api/avatar/tus
 func AuthMiddleware(grpcClient clients.GRPCClient) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Пропускаем запросы к /api/avatars без аутентификации
-			if r.URL.Path == "/api/avatars" && r.Method == "POST" {
-				log.Printf("[AUTH] Skipping authentication for /api/avatars")
+			// Пропускаем пакетные запросы аватарок без токена
+			optional := optionalAuthPaths[r.URL.Path] && r.Method == "POST"
+			if optional && r.Header.Get("Authorization") == "" {
+				log.Printf("[AUTH] Skipping authentication for %s", r.URL.Path)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Запрос возможностей tus (OPTIONS) не раскрывает данных пользователя
+			if r.URL.Path == "/api/avatar/tus" && r.Method == http.MethodOptions {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -63,6 +78,11 @@ func AuthMiddleware(grpcClient clients.GRPCClient) func(http.Handler) http.Handl
 			token = strings.TrimSpace(token)
 			log.Printf("[AUTH] Final token (after cleanup): %q (length: %d)", token, len(token))
 
+			if token == "" && optional {
+				log.Printf("[AUTH] Token is empty, serving %s anonymously", r.URL.Path)
+				next.ServeHTTP(w, r)
+				return
+			}
 			if token == "" {
 				log.Printf("[AUTH] ERROR: Token is empty after processing")
 				respondWithError(w, http.StatusUnauthorized, "Token is empty")
@@ -72,6 +92,12 @@ func AuthMiddleware(grpcClient clients.GRPCClient) func(http.Handler) http.Handl
 			// Валидируем токен через gRPC
 			log.Printf("[AUTH] Validating token via gRPC...")
 			user, err := grpcClient.ValidateToken(r.Context(), token)
+			if err != nil && optional {
+				// Устаревший токен не должен ломать запросы, которые работали без него
+				log.Printf("[AUTH] Token validation failed, serving %s anonymously: %v", r.URL.Path, err)
+				next.ServeHTTP(w, r)
+				return
+			}
 			if err != nil {
 				log.Printf("[AUTH] ERROR: Token validation failed: %v", err)
 				// Возвращаем детальную ошибку от gRPC
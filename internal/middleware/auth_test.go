@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/S0rgi/Gainly_Avatars/pkg/proto"
+)
+
+// fakeUserService принимает только токен "valid"
+type fakeUserService struct{}
+
+func (fakeUserService) ValidateToken(ctx context.Context, token string) (*pb.UserResponse, error) {
+	if token != "valid" {
+		return nil, errors.New("token expired")
+	}
+	return &pb.UserResponse{Id: "1", Username: "alice"}, nil
+}
+
+func (fakeUserService) GetUserById(ctx context.Context, userId string) (*pb.UserResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (fakeUserService) CheckFriendship(ctx context.Context, userId, friendName string) (*pb.FriendshipResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (fakeUserService) Close() error {
+	return nil
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := AuthMiddleware(fakeUserService{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := GetUserFromContext(r.Context()); ok {
+			w.Write([]byte(user.Id))
+		}
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		status int
+		user   string
+	}{
+		{"batch without token", http.MethodPost, "/api/avatars", "", http.StatusOK, ""},
+		{"batch with valid token", http.MethodPost, "/api/avatars", "Bearer valid", http.StatusOK, "1"},
+		{"batch with expired token", http.MethodPost, "/api/avatars", "Bearer expired", http.StatusOK, ""},
+		{"batch by id with empty bearer", http.MethodPost, "/api/avatars/by-id", `"Bearer "`, http.StatusOK, ""},
+		{"avatar with expired token", http.MethodGet, "/api/avatar", "Bearer expired", http.StatusUnauthorized, ""},
+		{"avatar without token", http.MethodGet, "/api/avatar", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.user {
+				t.Fatalf("user = %q, want %q", rec.Body.String(), tt.user)
+			}
+		})
+	}
+}
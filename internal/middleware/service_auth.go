@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// ServiceAuthMiddleware middleware для вызовов от других сервисов (события UserService).
+// Требует заголовок "Authorization: Bearer <secret>" с общим секретом
+func ServiceAuthMiddleware(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+				respondWithError(w, http.StatusUnauthorized, "Invalid service token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,128 +1,390 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
 	"github.com/google/uuid"
 )
 
+// MaxAvatarSize максимальный размер загружаемого файла аватарки
+const MaxAvatarSize = 10 << 20
+
+// ErrAvatarTooLarge файл аватарки превышает MaxAvatarSize
+var ErrAvatarTooLarge = fmt.Errorf("avatar file is too large: maximum is %d bytes", MaxAvatarSize)
+
 type AvatarService struct {
-	r2Client    *clients.R2Client
-	redisClient *clients.RedisClient
+	storage      clients.BlobStorage
+	metadata     clients.MetadataStore
+	encoder      imaging.Encoder
+	defaultStyle imaging.PlaceholderStyle
+	fetcher      *clients.RemoteFetcher
+	importers    Importers
+	urls         URLOptions
+	presigned    *presignCache
+	retention    RetentionOptions
+	users        clients.GRPCClient
+	friendships  *friendshipCache
+
+	// knownDefaults идентификаторы аватарок по умолчанию, уже сохраненных в хранилище
+	knownDefaults sync.Map
+	// uploadLocks мьютексы возобновляемых загрузок, чтобы части одной загрузки
+	// не записывались параллельно
+	uploadLocks sync.Map
 }
 
-func NewAvatarService(r2Client *clients.R2Client, redisClient *clients.RedisClient) *AvatarService {
+func NewAvatarService(storage clients.BlobStorage, metadata clients.MetadataStore, encoder imaging.Encoder, defaultStyle imaging.PlaceholderStyle, fetcher *clients.RemoteFetcher, importers Importers, urls URLOptions, retention RetentionOptions, users clients.GRPCClient) *AvatarService {
+	if urls.Strategy == "" {
+		urls.Strategy = URLStrategyPresigned
+	}
+	if urls.PresignExpiry <= 0 {
+		urls.PresignExpiry = DefaultPresignExpiry
+	}
+
 	return &AvatarService{
-		r2Client:    r2Client,
-		redisClient: redisClient,
+		storage:      storage,
+		metadata:     metadata,
+		encoder:      encoder,
+		defaultStyle: defaultStyle,
+		fetcher:      fetcher,
+		importers:    importers,
+		urls:         urls,
+		presigned:    newPresignCache(urls.PresignExpiry),
+		retention:    retention,
+		users:        users,
+		friendships:  newFriendshipCache(friendshipCacheTTL),
 	}
 }
 
-// AddAvatar добавляет новую аватарку
-func (s *AvatarService) AddAvatar(ctx context.Context, username string, file io.Reader, filename string, contentType string, size int64) (string, error) {
-	// Генерируем новый GUID
-	guid := uuid.New().String()
+// AddAvatar добавляет новую аватарку. Тип файла определяется по содержимому,
+// Content-Type клиента не учитывается. Сохраняется квадратное перекодированное
+// изображение без метаданных. Аватарка принадлежит userID, username становится его псевдонимом
+func (s *AvatarService) AddAvatar(ctx context.Context, userID, username string, file io.Reader, filename string, opts UploadOptions) (string, error) {
+	if userID == "" {
+		return "", errors.New("user id is required to add an avatar")
+	}
 
-	// Загружаем файл в R2
-	if err := s.r2Client.UploadAvatar(ctx, guid, file, contentType, size); err != nil {
-		return "", fmt.Errorf("failed to upload avatar: %w", err)
+	data, err := io.ReadAll(io.LimitReader(file, MaxAvatarSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if len(data) > MaxAvatarSize {
+		return "", ErrAvatarTooLarge
 	}
 
-	// Сохраняем метаданные в Redis
+	processed, err := s.processAvatar(data, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// Объект хранится по хэшу содержимого: одинаковые загрузки разделяют один объект
+	objectID := contentObjectID(processed.data)
+	variants, err := s.acquireAvatarObject(ctx, objectID, processed)
+	if err != nil {
+		return "", err
+	}
+
+	// Генерируем новый GUID
+	guid := uuid.New().String()
+
+	// Сохраняем метаданные
 	metadata := &clients.AvatarMetadata{
 		GUID:       guid,
+		ObjectID:   objectID,
+		UserID:     userID,
 		Username:   username,
 		Filename:   filename,
-		Size:       size,
-		MimeType:   contentType,
+		Size:       int64(len(processed.data)),
+		MimeType:   processed.contentType,
 		UploadedAt: time.Now(),
+		Variants:   variants,
+		Crop:       processed.crop,
+		Source:     opts.Source,
 	}
+	if metadata.Source == "" {
+		metadata.Source = clients.AvatarSourceUpload
+	}
+	// Видимость - настройка пользователя, новая аватарка наследует ее от текущей
+	metadata.Visibility = s.currentVisibility(ctx, userID)
 
-	if err := s.redisClient.SetAvatarMetadata(ctx, metadata); err != nil {
-		// Если не удалось сохранить метаданные, удаляем файл из R2
-		_ = s.r2Client.DeleteAvatar(ctx, guid)
+	if err := s.metadata.SetAvatarMetadata(ctx, metadata); err != nil {
+		// Если не удалось сохранить метаданные, освобождаем объект
+		s.discardAvatarObject(ctx, objectID)
 		return "", fmt.Errorf("failed to save metadata: %w", err)
 	}
 
-	// Обновляем связь username -> GUID
-	if err := s.redisClient.SetGUIDByUsername(ctx, username, guid); err != nil {
-		// Если не удалось сохранить связь, удаляем метаданные и файл
-		_ = s.redisClient.DeleteAvatarMetadata(ctx, guid)
-		_ = s.r2Client.DeleteAvatar(ctx, guid)
-		return "", fmt.Errorf("failed to save username mapping: %w", err)
+	// Атомарно заменяем текущую аватарку пользователя, получая предыдущий GUID
+	oldGUID, err := s.metadata.SwapGUIDByUserID(ctx, userID, guid)
+	if err != nil {
+		// Если не удалось сохранить связь, удаляем метаданные и освобождаем объект
+		_ = s.metadata.DeleteAvatarMetadata(ctx, guid)
+		s.discardAvatarObject(ctx, objectID)
+		return "", fmt.Errorf("failed to save avatar mapping: %w", err)
+	}
+
+	// Псевдоним username -> ID для поиска аватарки по username. Если не сохранился,
+	// его повторит SyncUsername при следующем запросе пользователя
+	if _, err := s.metadata.SetUsername(ctx, userID, username); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to save username of user %s: %v", userID, err)
+	}
+
+	// Предыдущая аватарка уходит в историю; не поместившиеся в историю удаляются,
+	// чтобы не копить неиспользуемые объекты
+	if oldGUID != "" && oldGUID != guid {
+		s.archiveAvatar(context.WithoutCancel(ctx), userID, oldGUID)
 	}
 
 	return guid, nil
 }
 
-// GetAvatarByUsername получает аватарку по username
-func (s *AvatarService) GetAvatarByUsername(ctx context.Context, username string) (string, error) {
-	guid, err := s.redisClient.GetGUIDByUsername(ctx, username)
+// AddAvatarFromURL загружает аватарку по внешнему URL через RemoteFetcher
+// (разрешенные хосты, только публичные адреса, ограничение размера и времени)
+func (s *AvatarService) AddAvatarFromURL(ctx context.Context, userID, username, rawURL string, opts UploadOptions) (string, error) {
+	file, err := s.fetcher.Fetch(ctx, rawURL)
 	if err != nil {
 		return "", err
 	}
 
-	// Генерируем presigned URL (действителен 1 час)
-	url, err := s.r2Client.GetAvatarPresignedURL(ctx, guid, 3600)
+	// Content-Type удаленного сервера не учитывается: тип определяется по содержимому
+	opts.Source = clients.AvatarSourceURL
+	return s.AddAvatar(ctx, userID, username, bytes.NewReader(file.Data), file.Filename, opts)
+}
+
+// removeAvatar удаляет метаданные аватарки, которая больше не используется
+// (замененной, вытесненной из истории или удаленной), и ее файлы, если на объект
+// не ссылаются другие аватарки. Ошибки только логируются
+func (s *AvatarService) removeAvatar(ctx context.Context, guid string) {
+	metadata, err := s.avatarMetadataOrLegacy(ctx, guid)
+	if err != nil {
+		log.Printf("[AVATAR] WARNING: failed to get avatar metadata %s: %v", guid, err)
+		return
+	}
+
+	remove, err := s.releaseAvatarObject(ctx, metadata)
+	if err != nil {
+		log.Printf("[AVATAR] WARNING: failed to release avatar %s: %v", guid, err)
+	}
+	if remove {
+		for _, id := range avatarObjectIDs(metadata.StorageID()) {
+			err := withRetry(ctx, cleanupAttempts, cleanupDelay, func() error {
+				return s.storage.DeleteAvatar(ctx, id)
+			})
+			if err != nil {
+				log.Printf("[AVATAR] WARNING: failed to delete avatar %s from storage: %v", id, err)
+			}
+		}
+		s.finishObjectDeletion(ctx, metadata.ObjectID)
+	}
+
+	err = withRetry(ctx, cleanupAttempts, cleanupDelay, func() error {
+		return s.metadata.DeleteAvatarMetadata(ctx, guid)
+	})
+	if err != nil {
+		log.Printf("[AVATAR] WARNING: failed to delete avatar metadata %s: %v", guid, err)
+	}
+}
+
+// deleteAvatarObjects удаляет оригинал и все копии объекта, игнорируя ошибки
+func (s *AvatarService) deleteAvatarObjects(ctx context.Context, objectID string) {
+	for _, id := range avatarObjectIDs(objectID) {
+		_ = s.storage.DeleteAvatar(ctx, id)
+	}
+}
+
+// avatarMetadataOrLegacy получает метаданные аватарки. Если их нет, возвращает
+// метаданные только с GUID: объект такой аватарки хранится как <guid>
+func (s *AvatarService) avatarMetadataOrLegacy(ctx context.Context, guid string) (*clients.AvatarMetadata, error) {
+	metadata, err := s.metadata.GetAvatarMetadata(ctx, guid)
+	if errors.Is(err, clients.ErrMetadataNotFound) {
+		return &clients.AvatarMetadata{GUID: guid}, nil
+	}
+	return metadata, err
+}
+
+// GetAvatarByUsername получает аватарку username для viewer. size > 0 выбирает
+// ближайшую уменьшенную копию, 0 - оригинал
+func (s *AvatarService) GetAvatarByUsername(ctx context.Context, viewer Viewer, username string, size int) (AvatarURL, error) {
+	objectID, metadata, err := s.avatarObjectID(ctx, viewer, username, size)
+	if err != nil {
+		return AvatarURL{}, err
+	}
+
+	// Ссылка согласно стратегии; presigned ссылки кэшируются, чтобы не менялись на каждый запрос
+	url, err := s.objectURL(ctx, viewer, username, size, objectID, metadata)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate avatar URL: %w", err)
+		return AvatarURL{}, err
 	}
 
-	return url, nil
+	return AvatarURL{URL: url, IsDefault: metadata == nil}, nil
 }
 
-// GetAvatarsByUsernames получает аватарки для списка username
-func (s *AvatarService) GetAvatarsByUsernames(ctx context.Context, usernames []string) (map[string]string, error) {
+// avatarObjectID возвращает объект аватарки username нужного размера и ее метаданные.
+// Если пользователь ничего не загружал или аватарка не видна viewer,
+// возвращается аватарка по умолчанию и nil вместо метаданных
+func (s *AvatarService) avatarObjectID(ctx context.Context, viewer Viewer, username string, size int) (string, *clients.AvatarMetadata, error) {
+	guid, err := s.metadata.GetGUIDByUsername(ctx, username)
+	if err != nil {
+		return s.fallbackObjectID(ctx, username, size, err)
+	}
+	return s.guidObjectID(ctx, viewer, username, guid, size)
+}
+
+// guidObjectID возвращает объект аватарки guid пользователя username нужного размера
+// и ее метаданные или аватарку по умолчанию, если аватарка не видна viewer
+func (s *AvatarService) guidObjectID(ctx context.Context, viewer Viewer, username, guid string, size int) (string, *clients.AvatarMetadata, error) {
+	metadata, err := s.metadata.GetAvatarMetadata(ctx, guid)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get avatar metadata: %w", err)
+	}
+	if !s.canView(ctx, viewer, username, metadata) {
+		return s.fallbackObjectID(ctx, username, size, fmt.Errorf("%w: %s", clients.ErrUsernameNotFound, username))
+	}
+	return objectIDForSize(metadata, size), metadata, nil
+}
+
+// fallbackObjectID возвращает аватарку по умолчанию вместо отсутствующей или скрытой.
+// Если аватарки по умолчанию отключены, возвращает err
+func (s *AvatarService) fallbackObjectID(ctx context.Context, username string, size int, err error) (string, *clients.AvatarMetadata, error) {
+	if !errors.Is(err, clients.ErrUsernameNotFound) || s.defaultStyle == imaging.PlaceholderNone {
+		return "", nil, err
+	}
+	objectID, err := s.defaultAvatarObject(ctx, username, size)
+	return objectID, nil, err
+}
+
+// GetAvatarsByUsernames получает аватарки для списка username.
+// Пользователям без загруженной или видимой viewer аватарки отдается аватарка по умолчанию
+func (s *AvatarService) GetAvatarsByUsernames(ctx context.Context, viewer Viewer, usernames []string, size int) (map[string]AvatarURL, error) {
 	// Получаем GUIDs для всех username
-	guidMap, err := s.redisClient.GetGUIDsByUsernames(ctx, usernames)
+	guidMap, err := s.metadata.GetGUIDsByUsernames(ctx, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	// Объект и копии определяются по метаданным, получаем их одним запросом
+	guids := make([]string, 0, len(guidMap))
+	for _, guid := range guidMap {
+		guids = append(guids, guid)
+	}
+	metadataMap, err := s.metadata.GetAvatarsMetadata(ctx, guids)
 	if err != nil {
 		return nil, err
 	}
 
-	result := make(map[string]string)
+	// Скрытые аватарки заменяются аватаркой по умолчанию, как отсутствующие
+	hidden := s.hiddenAvatars(ctx, viewer, guidMap, metadataMap)
 	for username, guid := range guidMap {
-		url, err := s.r2Client.GetAvatarPresignedURL(ctx, guid, 3600)
+		if hidden[guid] {
+			delete(guidMap, username)
+		}
+	}
+
+	result := make(map[string]AvatarURL)
+	for username, guid := range guidMap {
+		objectID := guid
+		metadata, ok := metadataMap[guid]
+		if ok {
+			objectID = objectIDForSize(metadata, size)
+		}
+
+		url, err := s.objectURL(ctx, viewer, username, size, objectID, metadata)
 		if err != nil {
 			// Пропускаем ошибки генерации URL
 			continue
 		}
-		result[username] = url
+		result[username] = AvatarURL{URL: url}
+	}
+
+	if s.defaultStyle == imaging.PlaceholderNone {
+		return result, nil
+	}
+	for _, username := range usernames {
+		if _, ok := guidMap[username]; ok {
+			continue
+		}
+		avatar, err := s.defaultAvatarURL(ctx, username, size)
+		if err != nil {
+			log.Printf("[AVATAR] WARNING: failed to get default avatar for %s: %v", username, err)
+			continue
+		}
+		result[username] = avatar
 	}
 
 	return result, nil
 }
 
-// GetMyAvatar получает аватарку текущего пользователя
-func (s *AvatarService) GetMyAvatar(ctx context.Context, username string) (string, error) {
-	return s.GetAvatarByUsername(ctx, username)
+// GetMyAvatar получает аватарку текущего пользователя по его ID.
+// username нужен для ссылки и аватарки по умолчанию
+func (s *AvatarService) GetMyAvatar(ctx context.Context, userID, username string, size int) (AvatarURL, error) {
+	viewer := Viewer{UserID: userID}
+
+	var objectID string
+	var metadata *clients.AvatarMetadata
+	guid, err := s.metadata.GetGUIDByUserID(ctx, userID)
+	if err != nil {
+		objectID, metadata, err = s.fallbackObjectID(ctx, username, size, err)
+	} else {
+		objectID, metadata, err = s.guidObjectID(ctx, viewer, username, guid, size)
+	}
+	if err != nil {
+		return AvatarURL{}, err
+	}
+
+	url, err := s.objectURL(ctx, viewer, username, size, objectID, metadata)
+	if err != nil {
+		return AvatarURL{}, err
+	}
+	return AvatarURL{URL: url, IsDefault: metadata == nil}, nil
 }
 
-// DeleteMyAvatar удаляет аватарку текущего пользователя
-func (s *AvatarService) DeleteMyAvatar(ctx context.Context, username string) error {
-	// Получаем GUID по username
-	guid, err := s.redisClient.GetGUIDByUsername(ctx, username)
+// DeleteMyAvatar удаляет аватарку текущего пользователя. При заданном
+// DeleteGrace аватарка только скрывается и может быть восстановлена до истечения срока
+func (s *AvatarService) DeleteMyAvatar(ctx context.Context, userID string) error {
+	guid, err := s.metadata.GetGUIDByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("avatar not found for user: %s", userID)
+	}
+
+	if s.retention.DeleteGrace > 0 {
+		return s.softDeleteAvatar(ctx, userID, guid)
+	}
+
+	metadata, err := s.avatarMetadataOrLegacy(ctx, guid)
 	if err != nil {
-		return fmt.Errorf("avatar not found for username: %s", username)
+		return fmt.Errorf("failed to get avatar metadata: %w", err)
 	}
 
-	// Удаляем файл из R2
-	if err := s.r2Client.DeleteAvatar(ctx, guid); err != nil {
-		return fmt.Errorf("failed to delete avatar from R2: %w", err)
+	// Удаляем файл и копии из хранилища, если на объект не ссылаются другие аватарки
+	remove, err := s.releaseAvatarObject(ctx, metadata)
+	if err != nil {
+		return err
+	}
+	if remove {
+		defer s.finishObjectDeletion(ctx, metadata.ObjectID)
+		for _, id := range avatarObjectIDs(metadata.StorageID()) {
+			if err := s.storage.DeleteAvatar(ctx, id); err != nil {
+				return fmt.Errorf("failed to delete avatar from storage: %w", err)
+			}
+		}
 	}
 
-	// Удаляем метаданные из Redis
-	if err := s.redisClient.DeleteAvatarMetadata(ctx, guid); err != nil {
+	// Удаляем метаданные
+	if err := s.metadata.DeleteAvatarMetadata(ctx, guid); err != nil {
 		// Логируем ошибку, но не возвращаем её, так как файл уже удален
-		fmt.Printf("warning: failed to delete metadata: %v\n", err)
+		log.Printf("[AVATAR] WARNING: failed to delete avatar metadata %s: %v", guid, err)
 	}
 
-	// Удаляем связь username -> GUID
-	if err := s.redisClient.DeleteUsernameMapping(ctx, username); err != nil {
-		fmt.Printf("warning: failed to delete username mapping: %v\n", err)
+	// Удаляем связь пользователя с аватаркой
+	if err := s.metadata.DeleteAvatarMapping(ctx, userID); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to delete avatar mapping of user %s: %v", userID, err)
 	}
 
 	return nil
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+)
+
+// newTestService создает сервис на хранилищах в памяти без аватарок по умолчанию
+func newTestService(t *testing.T, retention RetentionOptions) (*AvatarService, *clients.MemoryStorage, *clients.MemoryMetadataStore) {
+	t.Helper()
+
+	encoder, err := imaging.NewEncoder("jpeg", 85, 80)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	storage := clients.NewMemoryStorage()
+	metadata := clients.NewMemoryMetadataStore()
+	service := NewAvatarService(storage, metadata, encoder, imaging.PlaceholderNone, nil, Importers{}, URLOptions{}, retention, nil)
+	return service, storage, metadata
+}
+
+// testImage возвращает PNG одного цвета: разные цвета дают разные объекты
+func testImage(t *testing.T, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// addAvatar загружает изображение и возвращает метаданные новой аватарки
+func addAvatar(t *testing.T, service *AvatarService, userID, username string, data []byte) *clients.AvatarMetadata {
+	t.Helper()
+
+	ctx := context.Background()
+	guid, err := service.AddAvatar(ctx, userID, username, bytes.NewReader(data), "avatar.png", UploadOptions{})
+	if err != nil {
+		t.Fatalf("AddAvatar(%s): %v", userID, err)
+	}
+	metadata, err := service.metadata.GetAvatarMetadata(ctx, guid)
+	if err != nil {
+		t.Fatalf("GetAvatarMetadata(%s): %v", guid, err)
+	}
+	return metadata
+}
+
+// assertObjectStored проверяет наличие оригинала и всех копий объекта в хранилище
+func assertObjectStored(t *testing.T, storage *clients.MemoryStorage, objectID string, stored bool) {
+	t.Helper()
+
+	for _, id := range avatarObjectIDs(objectID) {
+		_, err := storage.HeadAvatar(context.Background(), id)
+		switch {
+		case stored && err != nil:
+			t.Errorf("HeadAvatar(%s): %v", id, err)
+		case !stored && !errors.Is(err, clients.ErrObjectNotFound):
+			t.Errorf("HeadAvatar(%s) error = %v, want ErrObjectNotFound", id, err)
+		}
+	}
+}
+
+func TestAddAvatarReplacesAndRemovesOldObject(t *testing.T) {
+	ctx := context.Background()
+	service, storage, metadata := newTestService(t, RetentionOptions{})
+
+	first := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{R: 255, A: 255}))
+	second := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{B: 255, A: 255}))
+	if first.ObjectID == second.ObjectID {
+		t.Fatalf("different images share object %s", first.ObjectID)
+	}
+
+	guid, err := metadata.GetGUIDByUserID(ctx, "1")
+	if err != nil || guid != second.GUID {
+		t.Fatalf("GetGUIDByUserID = %q, %v, want %q", guid, err, second.GUID)
+	}
+	guid, err = metadata.GetGUIDByUsername(ctx, "alice")
+	if err != nil || guid != second.GUID {
+		t.Fatalf("GetGUIDByUsername = %q, %v, want %q", guid, err, second.GUID)
+	}
+
+	// Без истории замененная аватарка удаляется вместе с объектом
+	if _, err := metadata.GetAvatarMetadata(ctx, first.GUID); !errors.Is(err, clients.ErrMetadataNotFound) {
+		t.Fatalf("GetAvatarMetadata(replaced) error = %v, want ErrMetadataNotFound", err)
+	}
+	assertObjectStored(t, storage, first.ObjectID, false)
+	assertObjectStored(t, storage, second.ObjectID, true)
+}
+
+func TestAddAvatarKeepsReplacedObjectInHistory(t *testing.T) {
+	ctx := context.Background()
+	service, storage, metadata := newTestService(t, RetentionOptions{HistoryDepth: 1})
+
+	first := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{R: 255, A: 255}))
+	second := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{G: 255, A: 255}))
+	third := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{B: 255, A: 255}))
+
+	history, err := metadata.GetAvatarHistory(ctx, "1")
+	if err != nil || len(history) != 1 || history[0] != second.GUID {
+		t.Fatalf("GetAvatarHistory = %v, %v, want [%s]", history, err, second.GUID)
+	}
+	// Вытесненная из истории аватарка удаляется
+	assertObjectStored(t, storage, first.ObjectID, false)
+	assertObjectStored(t, storage, second.ObjectID, true)
+	assertObjectStored(t, storage, third.ObjectID, true)
+}
+
+func TestAddAvatarSharesObjectBetweenUsers(t *testing.T) {
+	ctx := context.Background()
+	service, storage, _ := newTestService(t, RetentionOptions{})
+
+	data := testImage(t, color.RGBA{R: 255, A: 255})
+	alice := addAvatar(t, service, "1", "alice", data)
+	bob := addAvatar(t, service, "2", "bob", data)
+	if alice.ObjectID != bob.ObjectID {
+		t.Fatalf("same image stored as %s and %s", alice.ObjectID, bob.ObjectID)
+	}
+	if alice.GUID == bob.GUID {
+		t.Fatalf("users share avatar %s", alice.GUID)
+	}
+
+	// Объект удаляется только вместе с последней ссылающейся на него аватаркой
+	if err := service.DeleteMyAvatar(ctx, "1"); err != nil {
+		t.Fatalf("DeleteMyAvatar(1): %v", err)
+	}
+	assertObjectStored(t, storage, alice.ObjectID, true)
+
+	if err := service.DeleteMyAvatar(ctx, "2"); err != nil {
+		t.Fatalf("DeleteMyAvatar(2): %v", err)
+	}
+	assertObjectStored(t, storage, alice.ObjectID, false)
+
+	// Повторная загрузка того же содержимого сохраняет объект заново
+	again := addAvatar(t, service, "1", "alice", data)
+	if again.ObjectID != alice.ObjectID {
+		t.Fatalf("same image stored as %s, want %s", again.ObjectID, alice.ObjectID)
+	}
+	assertObjectStored(t, storage, again.ObjectID, true)
+}
+
+func TestGetAvatarsByUsernames(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t, RetentionOptions{})
+
+	alice := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{R: 255, A: 255}))
+	bob := addAvatar(t, service, "2", "bob", testImage(t, color.RGBA{B: 255, A: 255}))
+	if err := service.SetAvatarVisibility(ctx, "2", clients.AvatarVisibilityPrivate); err != nil {
+		t.Fatalf("SetAvatarVisibility: %v", err)
+	}
+
+	usernames := []string{"alice", "bob", "carol"}
+
+	// Аноним видит только публичные аватарки, неизвестные username пропускаются
+	avatars, err := service.GetAvatarsByUsernames(ctx, Viewer{}, usernames, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUsernames: %v", err)
+	}
+	if len(avatars) != 1 || !strings.Contains(avatars["alice"].URL, alice.ObjectID) {
+		t.Fatalf("anonymous avatars = %v, want only alice", avatars)
+	}
+
+	// Владелец видит свою приватную аватарку
+	avatars, err = service.GetAvatarsByUsernames(ctx, Viewer{UserID: "2"}, usernames, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUsernames: %v", err)
+	}
+	if len(avatars) != 2 || !strings.Contains(avatars["bob"].URL, bob.ObjectID) {
+		t.Fatalf("owner avatars = %v, want alice and bob", avatars)
+	}
+
+	// Поиск по ID работает через индекс username; без UserService неизвестные ID пропускаются
+	byID, err := service.GetAvatarsByUserIDs(ctx, Viewer{}, []string{"1", "2", "3"}, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUserIDs: %v", err)
+	}
+	if len(byID) != 1 || byID["1"] != avatars["alice"] {
+		t.Fatalf("avatars by id = %v, want only user 1", byID)
+	}
+}
+
+func TestGetAvatarsByUsernamesAfterRename(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t, RetentionOptions{})
+
+	alice := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{R: 255, A: 255}))
+	if err := service.RenameUser(ctx, "1", "alice2"); err != nil {
+		t.Fatalf("RenameUser: %v", err)
+	}
+
+	avatars, err := service.GetAvatarsByUsernames(ctx, Viewer{}, []string{"alice", "alice2"}, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUsernames: %v", err)
+	}
+	if _, ok := avatars["alice"]; ok || !strings.Contains(avatars["alice2"].URL, alice.ObjectID) {
+		t.Fatalf("avatars = %v, want only alice2", avatars)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// Сколько ждать, пока удаляется объект с тем же содержимым (см. clients.ErrObjectDeleting)
+const (
+	acquireAttempts = 5
+	acquireDelay    = 100 * time.Millisecond
+)
+
+// contentObjectID возвращает идентификатор объекта по SHA-256 нормализованного
+// изображения. Одинаковые загрузки (например повторный импорт того же фото
+// Telegram) получают один идентификатор и разделяют один объект в хранилище
+func contentObjectID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// acquireAvatarObject увеличивает счетчик ссылок на объект и сохраняет его
+// вместе с копиями, если такого содержимого в хранилище еще нет.
+// Если объект с тем же содержимым как раз удаляется, ссылка берется после
+// удаления, и объект загружается заново. Возвращает размеры копий
+func (s *AvatarService) acquireAvatarObject(ctx context.Context, objectID string, processed *processedAvatar) ([]int, error) {
+	err := withRetry(ctx, acquireAttempts, acquireDelay, func() error {
+		_, err := s.metadata.AcquireObject(ctx, objectID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reference avatar object: %w", err)
+	}
+
+	variants, err := s.ensureAvatarObject(ctx, objectID, processed)
+	if err != nil {
+		s.discardAvatarObject(ctx, objectID)
+		return nil, err
+	}
+	return variants, nil
+}
+
+// ensureAvatarObject загружает объект и копии, если оригинала еще нет. Копии
+// загружаются первыми, поэтому наличие оригинала означает, что объект сохранен целиком
+func (s *AvatarService) ensureAvatarObject(ctx context.Context, objectID string, processed *processedAvatar) ([]int, error) {
+	_, err := s.storage.HeadAvatar(ctx, objectID)
+	if err == nil {
+		return slices.Clone(VariantSizes), nil
+	}
+	if !errors.Is(err, clients.ErrObjectNotFound) {
+		return nil, fmt.Errorf("failed to check avatar object: %w", err)
+	}
+
+	variants, err := s.uploadVariants(ctx, objectID, processed.image)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(processed.data))
+	if err := s.storage.UploadAvatar(ctx, objectID, bytes.NewReader(processed.data), processed.contentType, size); err != nil {
+		return nil, fmt.Errorf("failed to upload avatar: %w", err)
+	}
+	return variants, nil
+}
+
+// releaseAvatarObject освобождает ссылку аватарки на объект и возвращает true,
+// если ссылок не осталось и объект с копиями нужно удалить. После удаления
+// вызывающий снимает метку удаления через finishObjectDeletion. Аватарки без
+// ObjectID, сохраненные до дедупликации, владеют объектом <guid> единолично
+func (s *AvatarService) releaseAvatarObject(ctx context.Context, metadata *clients.AvatarMetadata) (bool, error) {
+	if metadata.ObjectID == "" {
+		return true, nil
+	}
+
+	refs, err := s.metadata.ReleaseObject(ctx, metadata.ObjectID)
+	if err != nil {
+		return false, fmt.Errorf("failed to release avatar object: %w", err)
+	}
+	return refs <= 0, nil
+}
+
+// discardAvatarObject освобождает ссылку на объект неудавшейся загрузки
+// и удаляет объект, если он больше никому не нужен. Ошибки игнорируются
+func (s *AvatarService) discardAvatarObject(ctx context.Context, objectID string) {
+	refs, err := s.metadata.ReleaseObject(ctx, objectID)
+	if err == nil && refs <= 0 {
+		s.deleteAvatarObjects(ctx, objectID)
+		s.finishObjectDeletion(ctx, objectID)
+	}
+}
+
+// finishObjectDeletion снимает метку удаления с объекта, файлы которого удалены,
+// чтобы новые загрузки того же содержимого не ждали. Ошибки только логируются:
+// метка истекает сама. Объекты <guid> без счетчика ссылок пропускаются
+func (s *AvatarService) finishObjectDeletion(ctx context.Context, objectID string) {
+	if objectID == "" {
+		return
+	}
+	if err := s.metadata.FinishObjectDeletion(ctx, objectID); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to finish deletion of avatar object %s: %v", objectID, err)
+	}
+}
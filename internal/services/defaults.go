@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+)
+
+// AvatarURL ссылка на аватарку пользователя
+type AvatarURL struct {
+	URL string `json:"url"`
+	// IsDefault true, если пользователь ничего не загружал и отдается сгенерированная аватарка
+	IsDefault bool `json:"is_default"`
+}
+
+// defaultObjectID возвращает идентификатор закэшированной аватарки по умолчанию.
+// Стиль входит в имя, чтобы смена DEFAULT_AVATAR_STYLE не отдавала старые картинки
+func defaultObjectID(style imaging.PlaceholderStyle, seed string, size int) string {
+	return fmt.Sprintf("default_%s_%s_%d", style, imaging.PlaceholderKey(seed), size)
+}
+
+// defaultSize выбирает размер аватарки по умолчанию из VariantSizes, чтобы
+// число закэшированных объектов на пользователя было ограничено
+func defaultSize(size int) int {
+	largest := VariantSizes[len(VariantSizes)-1]
+	if size <= 0 {
+		return largest
+	}
+	for _, variant := range VariantSizes {
+		if variant >= size {
+			return variant
+		}
+	}
+	return largest
+}
+
+// defaultAvatarURL возвращает ссылку на аватарку по умолчанию для username
+func (s *AvatarService) defaultAvatarURL(ctx context.Context, username string, size int) (AvatarURL, error) {
+	objectID, err := s.defaultAvatarObject(ctx, username, size)
+	if err != nil {
+		return AvatarURL{}, err
+	}
+
+	url, err := s.objectURL(ctx, Viewer{}, username, size, objectID, nil)
+	if err != nil {
+		return AvatarURL{}, err
+	}
+	return AvatarURL{URL: url, IsDefault: true}, nil
+}
+
+// defaultAvatarObject возвращает объект аватарки по умолчанию для username.
+// Картинка генерируется при первом запросе и сохраняется в хранилище
+func (s *AvatarService) defaultAvatarObject(ctx context.Context, username string, size int) (string, error) {
+	size = defaultSize(size)
+	objectID := defaultObjectID(s.defaultStyle, username, size)
+
+	if err := s.ensureDefaultAvatar(ctx, objectID, username, size); err != nil {
+		return "", err
+	}
+	return objectID, nil
+}
+
+// ensureDefaultAvatar генерирует и загружает аватарку по умолчанию, если ее еще нет.
+// Уже проверенные объекты запоминаются, чтобы не делать HEAD на каждый запрос
+func (s *AvatarService) ensureDefaultAvatar(ctx context.Context, objectID, username string, size int) error {
+	if _, ok := s.knownDefaults.Load(objectID); ok {
+		return nil
+	}
+
+	_, err := s.storage.HeadAvatar(ctx, objectID)
+	if err == nil {
+		s.knownDefaults.Store(objectID, struct{}{})
+		return nil
+	}
+	if !errors.Is(err, clients.ErrObjectNotFound) {
+		return fmt.Errorf("failed to check default avatar: %w", err)
+	}
+
+	img, err := imaging.Placeholder(s.defaultStyle, username, size)
+	if err != nil {
+		return fmt.Errorf("failed to generate default avatar: %w", err)
+	}
+	data, format, err := s.encoder.Encode(img)
+	if err != nil {
+		return fmt.Errorf("failed to encode default avatar: %w", err)
+	}
+
+	// Генерация детерминирована, поэтому одновременная загрузка одного объекта безопасна
+	if err := s.storage.UploadAvatar(ctx, objectID, bytes.NewReader(data), format.MimeType(), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to upload default avatar: %w", err)
+	}
+
+	s.knownDefaults.Store(objectID, struct{}{})
+	return nil
+}
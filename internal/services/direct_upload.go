@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	"github.com/google/uuid"
+)
+
+// uploadURLExpiry время жизни ссылки для прямой загрузки
+const uploadURLExpiry = 15 * time.Minute
+
+var (
+	// ErrInvalidUploadRequest неверный Content-Type или размер в запросе ссылки для загрузки
+	ErrInvalidUploadRequest = errors.New("invalid upload request")
+	// ErrUploadExpired ссылка для загрузки истекла до завершения
+	ErrUploadExpired = errors.New("upload expired")
+	// ErrUploadIncomplete файл еще не загружен в хранилище
+	ErrUploadIncomplete = errors.New("upload is not complete")
+	// ErrUploadMismatch загруженный файл не совпадает с заявленными Content-Type или размером
+	ErrUploadMismatch = errors.New("uploaded object does not match the upload request")
+)
+
+// UploadURL ссылка для загрузки файла напрямую в хранилище
+type UploadURL struct {
+	UploadID string `json:"upload_id"`
+	URL      string `json:"url"`
+	Method   string `json:"method"`
+	// Headers заголовки, которые клиент обязан передать в запросе загрузки
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// uploadObjectID возвращает идентификатор временного объекта прямой загрузки
+func uploadObjectID(uploadID string) string {
+	return "upload_" + uploadID
+}
+
+// CreateUploadURL создает ссылку для загрузки аватарки клиентом напрямую в хранилище
+// (PUT с заданными Content-Type и размером). Загрузку нужно завершить через CompleteUpload
+func (s *AvatarService) CreateUploadURL(ctx context.Context, userID, username, contentType string, size int64) (*UploadURL, error) {
+	format, ok := imaging.FormatFromMimeType(contentType)
+	if !ok {
+		return nil, fmt.Errorf("%w: content type %q is not allowed", imaging.ErrUnsupportedFormat, contentType)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: size must be positive", ErrInvalidUploadRequest)
+	}
+	if size > MaxAvatarSize {
+		return nil, ErrAvatarTooLarge
+	}
+
+	now := time.Now()
+	upload := &clients.PendingUpload{
+		ID:          uuid.New().String(),
+		Kind:        clients.UploadKindDirect,
+		UserID:      userID,
+		Username:    username,
+		ContentType: format.MimeType(),
+		Size:        size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(uploadURLExpiry),
+	}
+
+	url, err := s.storage.GetUploadPresignedURL(ctx, uploadObjectID(upload.ID), upload.ContentType, upload.Size, int64(uploadURLExpiry.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate upload URL: %w", err)
+	}
+
+	if err := s.metadata.SetPendingUpload(ctx, upload); err != nil {
+		return nil, fmt.Errorf("failed to save pending upload: %w", err)
+	}
+
+	return &UploadURL{
+		UploadID:  upload.ID,
+		URL:       url,
+		Method:    "PUT",
+		Headers:   map[string]string{"Content-Type": upload.ContentType},
+		ExpiresAt: upload.ExpiresAt,
+	}, nil
+}
+
+// CompleteUpload проверяет загруженный напрямую файл (HEAD, затем полная проверка
+// изображения), сохраняет его как текущую аватарку пользователя.
+// Временный объект удаляется после сохранения или если файл непригоден
+// (истек срок, не совпадает с заявленным, не является допустимым изображением)
+func (s *AvatarService) CompleteUpload(ctx context.Context, userID, username, uploadID string, opts UploadOptions) (string, error) {
+	upload, err := s.metadata.GetPendingUpload(ctx, uploadID)
+	if err != nil {
+		return "", err
+	}
+	// Чужие загрузки не раскрываем. Владелец определяется по ID:
+	// username мог смениться или достаться другому пользователю
+	if upload.UserID != userID {
+		return "", fmt.Errorf("%w: %s", clients.ErrUploadNotFound, uploadID)
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		s.discardUpload(context.WithoutCancel(ctx), uploadID)
+		return "", ErrUploadExpired
+	}
+
+	objectID := uploadObjectID(uploadID)
+	info, err := s.storage.HeadAvatar(ctx, objectID)
+	if errors.Is(err, clients.ErrObjectNotFound) {
+		return "", ErrUploadIncomplete
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check uploaded object: %w", err)
+	}
+
+	// Проверку подписи ссылки дублируем: не все хранилища ее обеспечивают
+	if info.Size != upload.Size || (info.ContentType != "" && info.ContentType != upload.ContentType) {
+		s.discardUpload(context.WithoutCancel(ctx), uploadID)
+		return "", fmt.Errorf("%w: expected %s of %d bytes, got %s of %d bytes",
+			ErrUploadMismatch, upload.ContentType, upload.Size, info.ContentType, info.Size)
+	}
+
+	file, err := s.storage.OpenAvatar(ctx, objectID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read uploaded object: %w", err)
+	}
+	defer file.Close()
+
+	guid, err := s.AddAvatar(ctx, userID, username, file, "avatar", opts)
+	if err != nil {
+		// Ошибки проверки изображения окончательны, загрузку нужно начинать заново.
+		// С неверной обрезкой можно повторить завершение с другими параметрами
+		if errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrInvalidImage) ||
+			errors.Is(err, ErrAvatarTooLarge) {
+			s.discardUpload(context.WithoutCancel(ctx), uploadID)
+		}
+		return "", err
+	}
+
+	s.discardUpload(context.WithoutCancel(ctx), uploadID)
+	return guid, nil
+}
+
+// discardUpload удаляет временный объект и запись о загрузке. Ошибки только логируются
+func (s *AvatarService) discardUpload(ctx context.Context, uploadID string) {
+	err := withRetry(ctx, cleanupAttempts, cleanupDelay, func() error {
+		return s.storage.DeleteAvatar(ctx, uploadObjectID(uploadID))
+	})
+	if err != nil {
+		log.Printf("[AVATAR] WARNING: failed to delete upload object %s: %v", uploadID, err)
+	}
+
+	if err := s.metadata.DeletePendingUpload(ctx, uploadID); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to delete pending upload %s: %v", uploadID, err)
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// friendshipCacheTTL сколько используется результат CheckFriendship: изменения
+// дружбы учитываются с этой задержкой
+const friendshipCacheTTL = 30 * time.Second
+
+// friendshipCache хранит результаты CheckFriendship для пар viewer и владельца
+// аватарки, чтобы пакетные запросы не проверяли дружбу через UserService каждый раз.
+// Как и presignCache, очищается целиком при смене окна, выровненного по часам
+type friendshipCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	start   time.Time
+	friends map[friendshipKey]bool
+}
+
+// friendshipKey ID пользователя, запрашивающего аватарку, и username владельца
+type friendshipKey struct {
+	viewer string
+	owner  string
+}
+
+func newFriendshipCache(ttl time.Duration) *friendshipCache {
+	return &friendshipCache{
+		window:  ttl,
+		friends: make(map[friendshipKey]bool),
+	}
+}
+
+// get возвращает результат проверки дружбы, полученный в текущем окне
+func (c *friendshipCache) get(viewer, owner string, now time.Time) (friends, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advance(now)
+	friends, ok = c.friends[friendshipKey{viewer, owner}]
+	return friends, ok
+}
+
+// put запоминает результат проверки дружбы до конца текущего окна
+func (c *friendshipCache) put(viewer, owner string, friends bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advance(now)
+	c.friends[friendshipKey{viewer, owner}] = friends
+}
+
+// advance очищает кэш, если началось новое окно
+func (c *friendshipCache) advance(now time.Time) {
+	start := now.Truncate(c.window)
+	if start.Equal(c.start) {
+		return
+	}
+	c.start = start
+	clear(c.friends)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// ErrVersionNotFound запрошенной аватарки нет в истории пользователя
+var ErrVersionNotFound = errors.New("avatar version not found")
+
+// RetentionOptions настройки хранения предыдущих аватарок
+type RetentionOptions struct {
+	// HistoryDepth сколько предыдущих аватарок хранится для восстановления;
+	// 0 - замененная аватарка удаляется сразу
+	HistoryDepth int
+	// DeleteGrace сколько удаленная аватарка хранится для восстановления;
+	// 0 - аватарка удаляется сразу
+	DeleteGrace time.Duration
+}
+
+// AvatarVersion предыдущая аватарка пользователя из истории
+type AvatarVersion struct {
+	GUID       string    `json:"guid"`
+	URL        string    `json:"url"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mime_type"`
+	Source     string    `json:"source,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// archiveAvatar переносит замененную аватарку в историю пользователя. Аватарки,
+// не поместившиеся в историю, удаляются. Ошибки только логируются
+func (s *AvatarService) archiveAvatar(ctx context.Context, userID, guid string) {
+	if s.retention.HistoryDepth <= 0 {
+		s.removeAvatar(ctx, guid)
+		return
+	}
+
+	evicted, err := s.metadata.PushAvatarHistory(ctx, userID, guid, s.retention.HistoryDepth)
+	if err != nil {
+		log.Printf("[AVATAR] WARNING: failed to save avatar %s to history: %v", guid, err)
+		s.removeAvatar(ctx, guid)
+		return
+	}
+	for _, id := range evicted {
+		s.removeAvatar(ctx, id)
+	}
+}
+
+// ListAvatarHistory возвращает предыдущие аватарки пользователя, начиная с последней.
+// size выбирает копию так же, как в GetAvatarByUsername
+func (s *AvatarService) ListAvatarHistory(ctx context.Context, userID string, size int) ([]AvatarVersion, error) {
+	guids, err := s.metadata.GetAvatarHistory(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataMap, err := s.metadata.GetAvatarsMetadata(ctx, guids)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]AvatarVersion, 0, len(guids))
+	for _, guid := range guids {
+		metadata, ok := metadataMap[guid]
+		if !ok {
+			continue
+		}
+
+		url, err := s.versionURL(ctx, objectIDForSize(metadata, size))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, AvatarVersion{
+			GUID:       guid,
+			URL:        url,
+			Size:       metadata.Size,
+			MimeType:   metadata.MimeType,
+			Source:     metadata.Source,
+			UploadedAt: metadata.UploadedAt,
+		})
+	}
+	return versions, nil
+}
+
+// versionURL возвращает ссылку на объект аватарки из истории. Адреса
+// /avatars/{username} отдают только текущую аватарку, поэтому при стратегии
+// proxy выдается presigned ссылка
+func (s *AvatarService) versionURL(ctx context.Context, objectID string) (string, error) {
+	if s.urls.Strategy == URLStrategyPublic {
+		return s.publicObjectURL(objectID), nil
+	}
+	return s.presignedURL(ctx, objectID)
+}
+
+// RestoreAvatarVersion делает аватарку guid из истории пользователя текущей.
+// Текущая аватарка при этом переносится в историю
+func (s *AvatarService) RestoreAvatarVersion(ctx context.Context, userID, guid string) error {
+	guids, err := s.metadata.GetAvatarHistory(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(guids, guid) {
+		return fmt.Errorf("%w: %s", ErrVersionNotFound, guid)
+	}
+
+	metadata, err := s.metadata.GetAvatarMetadata(ctx, guid)
+	if err != nil {
+		if errors.Is(err, clients.ErrMetadataNotFound) {
+			return fmt.Errorf("%w: %s", ErrVersionNotFound, guid)
+		}
+		return fmt.Errorf("failed to get avatar metadata: %w", err)
+	}
+
+	// Видимость не откатывается вместе с аватаркой
+	if visibility := s.currentVisibility(ctx, userID); metadata.Visibility != visibility {
+		metadata.Visibility = visibility
+		if err := s.metadata.SetAvatarMetadata(ctx, metadata); err != nil {
+			return fmt.Errorf("failed to save metadata: %w", err)
+		}
+	}
+
+	oldGUID, err := s.metadata.SwapGUIDByUserID(ctx, userID, guid)
+	if err != nil {
+		return fmt.Errorf("failed to save avatar mapping: %w", err)
+	}
+
+	// Восстановленная аватарка больше не относится к истории
+	if err := s.metadata.RemoveAvatarHistory(ctx, userID, guid); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to remove restored avatar %s from history: %v", guid, err)
+	}
+	if oldGUID != "" && oldGUID != guid {
+		s.archiveAvatar(context.WithoutCancel(ctx), userID, oldGUID)
+	}
+	return nil
+}
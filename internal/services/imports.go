@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+var (
+	// ErrImportNotConfigured импорт из внешнего сервиса не настроен
+	ErrImportNotConfigured = errors.New("avatar import source is not configured")
+	// ErrNoEmail у пользователя нет email для поиска Gravatar
+	ErrNoEmail = errors.New("user has no email")
+)
+
+// Importers клиенты внешних сервисов для импорта аватарок; nil - импорт отключен
+type Importers struct {
+	Telegram *clients.TelegramClient
+	Gravatar *clients.GravatarClient
+	OAuth    *clients.OAuthAvatarClient
+}
+
+// ImportTelegramAvatar загружает текущее фото профиля Telegram пользователя через Bot API
+func (s *AvatarService) ImportTelegramAvatar(ctx context.Context, userID, username string, telegramUserID int64, opts UploadOptions) (string, error) {
+	if s.importers.Telegram == nil {
+		return "", ErrImportNotConfigured
+	}
+
+	file, err := s.importers.Telegram.DownloadProfilePhoto(ctx, telegramUserID)
+	if err != nil {
+		return "", err
+	}
+
+	opts.Source = clients.AvatarSourceTelegram
+	return s.importFile(ctx, userID, username, file, opts)
+}
+
+// ImportGravatar загружает Gravatar, привязанный к email пользователя
+func (s *AvatarService) ImportGravatar(ctx context.Context, userID, username, email string, opts UploadOptions) (string, error) {
+	if s.importers.Gravatar == nil {
+		return "", ErrImportNotConfigured
+	}
+	if strings.TrimSpace(email) == "" {
+		return "", ErrNoEmail
+	}
+
+	file, err := s.importers.Gravatar.DownloadAvatar(ctx, email)
+	if err != nil {
+		return "", err
+	}
+
+	opts.Source = clients.AvatarSourceGravatar
+	return s.importFile(ctx, userID, username, file, opts)
+}
+
+// ImportOAuthAvatar загружает картинку профиля OAuth провайдера (например picture Google)
+func (s *AvatarService) ImportOAuthAvatar(ctx context.Context, userID, username, provider, pictureURL string, opts UploadOptions) (string, error) {
+	if s.importers.OAuth == nil {
+		return "", ErrImportNotConfigured
+	}
+
+	file, err := s.importers.OAuth.DownloadAvatar(ctx, provider, pictureURL)
+	if err != nil {
+		return "", err
+	}
+
+	opts.Source = clients.AvatarSourceOAuthPrefix + strings.ToLower(provider)
+	return s.importFile(ctx, userID, username, file, opts)
+}
+
+// importFile сохраняет скачанный файл как обычную загрузку: тип определяется
+// по содержимому, изображение проверяется и нормализуется
+func (s *AvatarService) importFile(ctx context.Context, userID, username string, file *clients.RemoteFile, opts UploadOptions) (string, error) {
+	return s.AddAvatar(ctx, userID, username, bytes.NewReader(file.Data), file.Filename, opts)
+}
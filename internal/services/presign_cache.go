@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPresignExpiry срок действия presigned ссылки, если он не задан
+const DefaultPresignExpiry = time.Hour
+
+// presignCache хранит presigned ссылки в пределах окна времени. Окна выровнены
+// по часам (now.Truncate(window)), а ссылки подписываются временем начала окна,
+// поэтому в течение окна для объекта все экземпляры сервиса отдают одну и ту же
+// ссылку, и браузеры и CDN могут кэшировать изображение.
+// Окно равно половине срока действия ссылки: ссылка, выданная в конце окна,
+// действует еще не меньше половины срока. При смене окна кэш очищается целиком,
+// так что в памяти хранятся только ссылки текущего окна
+type presignCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	start  time.Time
+	urls   map[string]string
+}
+
+func newPresignCache(expiry time.Duration) *presignCache {
+	return &presignCache{
+		window: expiry / 2,
+		urls:   make(map[string]string),
+	}
+}
+
+// windowStart возвращает начало окна, в которое попадает now
+func (c *presignCache) windowStart(now time.Time) time.Time {
+	return now.Truncate(c.window)
+}
+
+// get возвращает ссылку на объект, выданную в текущем окне
+func (c *presignCache) get(objectID string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advance(now)
+	url, ok := c.urls[objectID]
+	return url, ok
+}
+
+// put запоминает ссылку на объект до конца текущего окна
+func (c *presignCache) put(objectID, url string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advance(now)
+	c.urls[objectID] = url
+}
+
+// advance очищает кэш, если началось новое окно
+func (c *presignCache) advance(now time.Time) {
+	start := c.windowStart(now)
+	if start.Equal(c.start) {
+		return
+	}
+	c.start = start
+	clear(c.urls)
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+)
+
+// UploadOptions дополнительные параметры загрузки аватарки
+type UploadOptions struct {
+	// Crop область обрезки; по умолчанию квадрат по центру
+	Crop imaging.Crop
+	// Source источник аватарки для метаданных; по умолчанию clients.AvatarSourceUpload
+	Source string
+}
+
+// processedAvatar результат обработки загруженного файла
+type processedAvatar struct {
+	data        []byte
+	contentType string
+	// image квадратное изображение для создания копий
+	image image.Image
+	// crop примененная область обрезки
+	crop *imaging.CropRect
+}
+
+// processAvatar проверяет файл, применяет EXIF ориентацию, обрезает до квадрата
+// и перекодирует, отбрасывая метаданные (GPS, модель камеры)
+func (s *AvatarService) processAvatar(data []byte, opts UploadOptions) (*processedAvatar, error) {
+	// Проверяем, что файл - изображение разрешенного формата
+	info, err := imaging.Validate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img := imaging.ApplyOrientation(info.Image, imaging.Orientation(data))
+
+	bounds := img.Bounds()
+	crop, err := opts.Crop.ResolveSquare(bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return nil, err
+	}
+	img = imaging.CropImage(img, crop)
+
+	encoded, format, err := s.encoder.Encode(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process avatar: %w", err)
+	}
+
+	return &processedAvatar{
+		data:        encoded,
+		contentType: format.MimeType(),
+		image:       img,
+		crop:        &crop,
+	}, nil
+}
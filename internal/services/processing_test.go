@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+)
+
+// exifMarker строка внутри EXIF, которой не должно быть в сохраненном файле
+const exifMarker = "GPS 55.7558N 37.6173E"
+
+// jpegWithExif возвращает JPEG с сегментом APP1 Exif, содержащим exifMarker
+func jpegWithExif(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	data := buf.Bytes()
+
+	// TIFF заголовок с пустым IFD, за ним данные, которые должны быть отброшены
+	payload := append([]byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00"), exifMarker...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	// Сегмент вставляется сразу после SOI
+	result := append([]byte{}, data[:2]...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+// avifWithExif возвращает AVIF контейнер с элементом Exif. Данные кодека не нужны:
+// файл должен быть отклонен до декодирования
+func avifWithExif() []byte {
+	box := func(typ string, body []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(body)+8))
+		return append(append(b, typ...), body...)
+	}
+	ftyp := box("ftyp", []byte("avif\x00\x00\x00\x00avifmif1miaf"))
+	ispe := box("ispe", []byte("\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x40"))
+	iinf := box("iinf", append([]byte("\x00\x00\x00\x00\x00\x02"),
+		append(box("infe", []byte("\x02\x00\x00\x00\x00\x01\x00\x00av01\x00")),
+			box("infe", []byte("\x02\x00\x00\x00\x00\x02\x00\x00Exif\x00"))...)...))
+	meta := box("meta", append([]byte("\x00\x00\x00\x00"), append(iinf, box("iprp", box("ipco", ispe))...)...))
+	mdat := box("mdat", append([]byte("\x00\x00\x00\x06Exif\x00\x00MM\x00\x2a"), exifMarker...))
+	return append(append(ftyp, meta...), mdat...)
+}
+
+func TestAddAvatarStripsExif(t *testing.T) {
+	ctx := context.Background()
+	service, storage, _ := newTestService(t, RetentionOptions{})
+
+	data := jpegWithExif(t)
+	if !bytes.Contains(data, []byte(exifMarker)) {
+		t.Fatalf("test image has no EXIF")
+	}
+	metadata := addAvatar(t, service, "1", "alice", data)
+
+	for _, id := range avatarObjectIDs(metadata.ObjectID) {
+		reader, err := storage.OpenAvatar(ctx, id)
+		if err != nil {
+			t.Fatalf("OpenAvatar(%s): %v", id, err)
+		}
+		stored, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", id, err)
+		}
+		if bytes.Contains(stored, []byte("Exif")) || bytes.Contains(stored, []byte(exifMarker)) {
+			t.Errorf("stored object %s keeps EXIF metadata", id)
+		}
+	}
+}
+
+func TestAddAvatarRejectsAVIFWithExif(t *testing.T) {
+	ctx := context.Background()
+	service, storage, metadata := newTestService(t, RetentionOptions{})
+
+	data := avifWithExif()
+	_, err := service.AddAvatar(ctx, "1", "alice", bytes.NewReader(data), "avatar.avif", UploadOptions{})
+	if !errors.Is(err, imaging.ErrUnsupportedFormat) {
+		t.Fatalf("AddAvatar(avif) error = %v, want ErrUnsupportedFormat", err)
+	}
+
+	// Ничего из файла не должно попасть в хранилище
+	if _, err := metadata.GetGUIDByUserID(ctx, "1"); err == nil {
+		t.Fatalf("avatar saved for rejected upload")
+	}
+	assertObjectStored(t, storage, contentObjectID(data), false)
+}
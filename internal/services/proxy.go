@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// AvatarObject аватарка для отдачи содержимого напрямую, без presigned ссылки
+type AvatarObject struct {
+	// ObjectID идентификатор объекта; совпадает с параметром v ссылок URLStrategyProxy
+	ObjectID string
+	Info     *clients.ObjectInfo
+	// Content содержимое объекта с поддержкой Seek для запросов Range.
+	// Закрывается вызывающим
+	Content *clients.ObjectReader
+	// IsDefault true, если отдается сгенерированная аватарка по умолчанию
+	IsDefault bool
+}
+
+// OpenAvatarByUsername открывает аватарку username для отдачи содержимого viewer.
+// size > 0 выбирает ближайшую уменьшенную копию, 0 - оригинал. Объект читается
+// из хранилища только при чтении Content
+func (s *AvatarService) OpenAvatarByUsername(ctx context.Context, viewer Viewer, username string, size int) (*AvatarObject, error) {
+	objectID, metadata, err := s.avatarObjectID(ctx, viewer, username, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.storage.HeadAvatar(ctx, objectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatar object: %w", err)
+	}
+
+	return &AvatarObject{
+		ObjectID:  objectID,
+		Info:      info,
+		Content:   clients.NewObjectReader(ctx, s.storage, objectID, info.Size),
+		IsDefault: metadata == nil,
+	}, nil
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// RenameUser делает username псевдонимом пользователя userID. Текущая аватарка,
+// история и удаленная аватарка принадлежат ID пользователя, поэтому ничего не
+// переносится: старый и новый username переключаются одной операцией хранилища.
+// Если новый username еще числится за другим пользователем (его смена не обработана),
+// username переходит к userID, а прежний владелец получит свой при синхронизации
+func (s *AvatarService) RenameUser(ctx context.Context, userID, username string) error {
+	previous, err := s.metadata.SetUsername(ctx, userID, username)
+	if err != nil {
+		return fmt.Errorf("failed to save username: %w", err)
+	}
+	if previous != "" && previous != username {
+		log.Printf("[AVATAR] User %s renamed: %s -> %s", userID, previous, username)
+	}
+	return nil
+}
+
+// SyncUsername сравнивает username из токена с сохраненным для userID и при
+// расхождении (username сменили в UserService) обновляет псевдоним через RenameUser
+func (s *AvatarService) SyncUsername(ctx context.Context, userID, username string) error {
+	if userID == "" || username == "" {
+		return nil
+	}
+
+	stored, err := s.metadata.GetUsernameByUserID(ctx, userID)
+	if err == nil && stored == username {
+		return nil
+	}
+	if err != nil && !errors.Is(err, clients.ErrUserIDNotFound) {
+		return err
+	}
+	return s.RenameUser(ctx, userID, username)
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	"github.com/google/uuid"
+)
+
+// resumableUploadExpiry время, за которое нужно закончить возобновляемую загрузку
+const resumableUploadExpiry = 24 * time.Hour
+
+// resumableContentType тип объекта до проверки: формат определяется по содержимому
+const resumableContentType = "application/octet-stream"
+
+// ErrUploadOffsetMismatch смещение в запросе не совпадает с числом полученных байт
+var ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+
+// resumableObjectID идентификатор объекта, собираемого из частей
+func resumableObjectID(uploadID string) string {
+	return "tus_" + uploadID
+}
+
+// resumableBufferID идентификатор объекта с полученными байтами, которых
+// пока меньше clients.MultipartMinPartSize и их нельзя отправить частью
+func resumableBufferID(uploadID string) string {
+	return "tus_" + uploadID + "_buffer"
+}
+
+// CreateResumableUpload начинает возобновляемую загрузку файла размером length.
+// metadata сохраняется как есть и возвращается клиенту, параметры обрезки
+// применяются по завершении загрузки
+func (s *AvatarService) CreateResumableUpload(ctx context.Context, userID, username string, length int64, filename, metadata string, crop imaging.Crop) (*clients.PendingUpload, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: upload length must be positive", ErrInvalidUploadRequest)
+	}
+	if length > MaxAvatarSize {
+		return nil, ErrAvatarTooLarge
+	}
+	if filename == "" {
+		filename = "avatar"
+	}
+
+	now := time.Now()
+	upload := &clients.PendingUpload{
+		ID:          uuid.New().String(),
+		Kind:        clients.UploadKindResumable,
+		UserID:      userID,
+		Username:    username,
+		ContentType: resumableContentType,
+		Size:        length,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(resumableUploadExpiry),
+		Filename:    filename,
+		Metadata:    metadata,
+	}
+	if crop.Rect != nil || crop.Focal != nil {
+		upload.Crop = &crop
+	}
+
+	multipartID, err := s.storage.CreateMultipartUpload(ctx, resumableObjectID(upload.ID), resumableContentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	upload.MultipartID = multipartID
+
+	if err := s.metadata.SetPendingUpload(ctx, upload); err != nil {
+		if abortErr := s.storage.AbortMultipartUpload(context.WithoutCancel(ctx), resumableObjectID(upload.ID), multipartID); abortErr != nil {
+			log.Printf("[AVATAR] WARNING: failed to abort multipart upload %s: %v", upload.ID, abortErr)
+		}
+		return nil, fmt.Errorf("failed to save pending upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// GetResumableUpload возвращает состояние возобновляемой загрузки пользователя
+func (s *AvatarService) GetResumableUpload(ctx context.Context, userID, uploadID string) (*clients.PendingUpload, error) {
+	upload, err := s.metadata.GetPendingUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	// Чужие загрузки и загрузки другого вида не раскрываем. Владелец определяется
+	// по ID: username мог смениться или достаться другому пользователю
+	if upload.UserID != userID || upload.Kind != clients.UploadKindResumable {
+		return nil, fmt.Errorf("%w: %s", clients.ErrUploadNotFound, uploadID)
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return upload, nil
+}
+
+// WriteResumableUpload дописывает данные с указанного смещения и возвращает новое смещение.
+// Полученные байты сохраняются, даже если соединение оборвалось на середине.
+// Когда получен весь файл, он собирается из частей, сохраняется как аватарка
+// и возвращается ее GUID
+func (s *AvatarService) WriteResumableUpload(ctx context.Context, userID, username, uploadID string, offset int64, body io.Reader) (int64, string, error) {
+	unlock := s.lockUpload(uploadID)
+	defer unlock()
+
+	upload, err := s.GetResumableUpload(ctx, userID, uploadID)
+	if err != nil {
+		return 0, "", err
+	}
+	if offset != upload.Offset {
+		return upload.Offset, "", fmt.Errorf("%w: expected %d, got %d", ErrUploadOffsetMismatch, upload.Offset, offset)
+	}
+
+	remaining := upload.Size - upload.Offset
+	chunk, readErr := io.ReadAll(io.LimitReader(body, remaining+1))
+	if int64(len(chunk)) > remaining {
+		return upload.Offset, "", fmt.Errorf("%w: data exceeds upload length of %d bytes", ErrInvalidUploadRequest, upload.Size)
+	}
+	if len(chunk) == 0 && readErr != nil {
+		return upload.Offset, "", fmt.Errorf("failed to read upload data: %w", readErr)
+	}
+
+	if err := s.appendResumableChunk(ctx, upload, chunk); err != nil {
+		return upload.Offset, "", err
+	}
+	if readErr != nil {
+		return upload.Offset, "", fmt.Errorf("failed to read upload data: %w", readErr)
+	}
+	if upload.Offset < upload.Size {
+		return upload.Offset, "", nil
+	}
+
+	guid, err := s.finishResumableUpload(ctx, userID, username, upload)
+	if err != nil {
+		return upload.Offset, "", err
+	}
+	return upload.Offset, guid, nil
+}
+
+// TerminateResumableUpload отменяет возобновляемую загрузку и удаляет полученные данные
+func (s *AvatarService) TerminateResumableUpload(ctx context.Context, userID, uploadID string) error {
+	unlock := s.lockUpload(uploadID)
+	defer unlock()
+
+	upload, err := s.metadata.GetPendingUpload(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	if upload.UserID != userID || upload.Kind != clients.UploadKindResumable {
+		return fmt.Errorf("%w: %s", clients.ErrUploadNotFound, uploadID)
+	}
+
+	s.discardResumableUpload(context.WithoutCancel(ctx), upload)
+	return nil
+}
+
+// appendResumableChunk добавляет chunk к буферу. Буфер отправляется частью
+// составной загрузки, когда достигает минимального размера части или когда
+// получен весь файл; иначе он сохраняется отдельным объектом.
+// При успехе обновляет upload.Offset и upload.Parts и сохраняет состояние
+func (s *AvatarService) appendResumableChunk(ctx context.Context, upload *clients.PendingUpload, chunk []byte) error {
+	buffered, err := s.readResumableBuffer(ctx, upload)
+	if err != nil {
+		return err
+	}
+	data := append(buffered, chunk...)
+
+	next := *upload
+	next.Offset += int64(len(chunk))
+	complete := next.Offset == next.Size
+
+	if complete || len(data) >= clients.MultipartMinPartSize {
+		if len(data) > 0 {
+			partNumber := int32(len(upload.Parts) + 1)
+			etag, err := s.storage.UploadPart(ctx, resumableObjectID(upload.ID), upload.MultipartID, partNumber, bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return fmt.Errorf("failed to upload part: %w", err)
+			}
+			next.Parts = append(append([]clients.UploadedPart(nil), upload.Parts...), clients.UploadedPart{
+				Number: partNumber,
+				ETag:   etag,
+				Size:   int64(len(data)),
+			})
+		}
+	} else if len(chunk) > 0 {
+		// Буфер перезаписывается целиком: если состояние не сохранится,
+		// прежнее смещение укажет на ту же начальную часть буфера
+		err := s.storage.UploadAvatar(ctx, resumableBufferID(upload.ID), bytes.NewReader(data), resumableContentType, int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("failed to store upload buffer: %w", err)
+		}
+	}
+
+	if err := s.metadata.SetPendingUpload(ctx, &next); err != nil {
+		return fmt.Errorf("failed to save pending upload: %w", err)
+	}
+	*upload = next
+	return nil
+}
+
+// readResumableBuffer читает полученные байты, еще не отправленные частью
+func (s *AvatarService) readResumableBuffer(ctx context.Context, upload *clients.PendingUpload) ([]byte, error) {
+	size := upload.Offset
+	for _, part := range upload.Parts {
+		size -= part.Size
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	file, err := s.storage.OpenAvatar(ctx, resumableBufferID(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload buffer: %w", err)
+	}
+	defer file.Close()
+
+	buffered := make([]byte, size)
+	if _, err := io.ReadFull(file, buffered); err != nil {
+		return nil, fmt.Errorf("failed to read upload buffer: %w", err)
+	}
+	return buffered, nil
+}
+
+// finishResumableUpload собирает объект из частей и сохраняет его как аватарку.
+// Загрузка после этого удаляется в любом случае: составная загрузка уже завершена
+func (s *AvatarService) finishResumableUpload(ctx context.Context, userID, username string, upload *clients.PendingUpload) (string, error) {
+	defer s.discardResumableUpload(context.WithoutCancel(ctx), upload)
+
+	objectID := resumableObjectID(upload.ID)
+	if err := s.storage.CompleteMultipartUpload(ctx, objectID, upload.MultipartID, upload.Parts); err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	upload.MultipartID = ""
+
+	file, err := s.storage.OpenAvatar(ctx, objectID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read uploaded object: %w", err)
+	}
+	defer file.Close()
+
+	opts := UploadOptions{}
+	if upload.Crop != nil {
+		opts.Crop = *upload.Crop
+	}
+	return s.AddAvatar(ctx, userID, username, file, upload.Filename, opts)
+}
+
+// discardResumableUpload отменяет составную загрузку, удаляет буфер, собранный
+// объект и запись о загрузке. Ошибки только логируются
+func (s *AvatarService) discardResumableUpload(ctx context.Context, upload *clients.PendingUpload) {
+	objectID := resumableObjectID(upload.ID)
+	if upload.MultipartID != "" {
+		err := withRetry(ctx, cleanupAttempts, cleanupDelay, func() error {
+			return s.storage.AbortMultipartUpload(ctx, objectID, upload.MultipartID)
+		})
+		if err != nil {
+			log.Printf("[AVATAR] WARNING: failed to abort multipart upload %s: %v", upload.ID, err)
+		}
+	}
+
+	for _, id := range []string{resumableBufferID(upload.ID), objectID} {
+		err := withRetry(ctx, cleanupAttempts, cleanupDelay, func() error {
+			return s.storage.DeleteAvatar(ctx, id)
+		})
+		if err != nil {
+			log.Printf("[AVATAR] WARNING: failed to delete upload object %s: %v", id, err)
+		}
+	}
+
+	if err := s.metadata.DeletePendingUpload(ctx, upload.ID); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to delete pending upload %s: %v", upload.ID, err)
+	}
+	s.uploadLocks.Delete(upload.ID)
+}
+
+// lockUpload захватывает мьютекс загрузки и возвращает функцию его освобождения
+func (s *AvatarService) lockUpload(uploadID string) func() {
+	value, _ := s.uploadLocks.LoadOrStore(uploadID, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return func() {
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	cleanupAttempts = 3
+	cleanupDelay    = 200 * time.Millisecond
+)
+
+// withRetry выполняет fn до attempts раз, удваивая задержку между попытками.
+// Возвращает последнюю ошибку, если все попытки неудачны
+func withRetry(ctx context.Context, attempts int, delay time.Duration, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if i == attempts-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
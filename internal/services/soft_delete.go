@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// softDeleteAvatar скрывает аватарку guid: связь пользователя с ней удаляется, а файлы
+// и метаданные хранятся до окончания срока восстановления. Восстановить можно
+// только последнюю удаленную аватарку, предыдущая удаляется окончательно
+func (s *AvatarService) softDeleteAvatar(ctx context.Context, userID, guid string) error {
+	previous, err := s.metadata.GetDeletedAvatar(ctx, userID)
+	if err != nil && !errors.Is(err, clients.ErrDeletedAvatarNotFound) {
+		return fmt.Errorf("failed to get deleted avatar: %w", err)
+	}
+
+	now := time.Now()
+	deleted := &clients.DeletedAvatar{
+		UserID:    userID,
+		GUID:      guid,
+		DeletedAt: now,
+		PurgeAt:   now.Add(s.retention.DeleteGrace),
+	}
+	if err := s.metadata.SetDeletedAvatar(ctx, deleted); err != nil {
+		return fmt.Errorf("failed to save deleted avatar: %w", err)
+	}
+
+	if err := s.metadata.DeleteAvatarMapping(ctx, userID); err != nil {
+		// Аватарка осталась текущей, запись для восстановления не нужна
+		_ = s.metadata.DeleteDeletedAvatar(ctx, userID)
+		return fmt.Errorf("failed to delete avatar mapping: %w", err)
+	}
+
+	if previous != nil && previous.GUID != guid {
+		s.removeAvatar(context.WithoutCancel(ctx), previous.GUID)
+	}
+	return nil
+}
+
+// RestoreDeletedAvatar восстанавливает последнюю удаленную аватарку пользователя, если
+// срок восстановления не истек. Загруженная после удаления аватарка переносится в историю.
+// Возвращает GUID восстановленной аватарки
+func (s *AvatarService) RestoreDeletedAvatar(ctx context.Context, userID string) (string, error) {
+	deleted, err := s.metadata.GetDeletedAvatar(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	// Запись могла еще не попасть в фоновую очистку
+	if !deleted.PurgeAt.After(time.Now()) {
+		return "", fmt.Errorf("%w: %s", clients.ErrDeletedAvatarNotFound, userID)
+	}
+
+	if _, err := s.metadata.GetAvatarMetadata(ctx, deleted.GUID); err != nil {
+		if errors.Is(err, clients.ErrMetadataNotFound) {
+			return "", fmt.Errorf("%w: %s", clients.ErrDeletedAvatarNotFound, userID)
+		}
+		return "", fmt.Errorf("failed to get avatar metadata: %w", err)
+	}
+
+	oldGUID, err := s.metadata.SwapGUIDByUserID(ctx, userID, deleted.GUID)
+	if err != nil {
+		return "", fmt.Errorf("failed to save avatar mapping: %w", err)
+	}
+
+	// Если запись не удалилась, фоновая очистка пропустит текущую аватарку
+	if err := s.metadata.DeleteDeletedAvatar(ctx, userID); err != nil {
+		log.Printf("[AVATAR] WARNING: failed to delete restored avatar record %s: %v", userID, err)
+	}
+	if oldGUID != "" && oldGUID != deleted.GUID {
+		s.archiveAvatar(context.WithoutCancel(ctx), userID, oldGUID)
+	}
+	return deleted.GUID, nil
+}
+
+// PurgeDeletedAvatars окончательно удаляет аватарки, срок восстановления которых
+// истек. Возвращает число удаленных аватарок
+func (s *AvatarService) PurgeDeletedAvatars(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		deletions, err := s.metadata.ListExpiredDeletions(ctx, time.Now(), purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list expired deletions: %w", err)
+		}
+
+		for _, deleted := range deletions {
+			// Аватарка могла быть восстановлена без удаления записи
+			guid, err := s.metadata.GetGUIDByUserID(ctx, deleted.UserID)
+			if err != nil && !errors.Is(err, clients.ErrUsernameNotFound) {
+				return purged, fmt.Errorf("failed to get guid by user id: %w", err)
+			}
+			if guid != deleted.GUID {
+				s.removeAvatar(ctx, deleted.GUID)
+			}
+
+			if err := s.metadata.DeleteDeletedAvatar(ctx, deleted.UserID); err != nil {
+				return purged, fmt.Errorf("failed to delete deleted avatar record: %w", err)
+			}
+			purged++
+		}
+
+		if len(deletions) < purgeBatchSize || ctx.Err() != nil {
+			return purged, ctx.Err()
+		}
+	}
+}
+
+// RunDeletionPurger периодически удаляет аватарки с истекшим сроком восстановления,
+// пока не отменен ctx
+func (s *AvatarService) RunDeletionPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeDeletedAvatars(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[AVATAR] WARNING: failed to purge deleted avatars: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("[AVATAR] Purged %d deleted avatars", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// purgeBatchSize сколько истекших загрузок обрабатывается за один запрос к хранилищу метаданных
+const purgeBatchSize = 100
+
+// PurgeExpiredUploads удаляет истекшие незавершенные загрузки: отменяет составные
+// загрузки в хранилище и удаляет временные объекты. Возвращает число удаленных загрузок
+func (s *AvatarService) PurgeExpiredUploads(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		uploads, err := s.metadata.ListExpiredUploads(ctx, time.Now(), purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list expired uploads: %w", err)
+		}
+
+		for _, upload := range uploads {
+			if upload.Kind == clients.UploadKindResumable {
+				unlock := s.lockUpload(upload.ID)
+				s.discardResumableUpload(ctx, upload)
+				unlock()
+			} else {
+				s.discardUpload(ctx, upload.ID)
+			}
+			purged++
+		}
+
+		if len(uploads) < purgeBatchSize || ctx.Err() != nil {
+			return purged, ctx.Err()
+		}
+	}
+}
+
+// RunUploadPurger периодически удаляет истекшие загрузки, пока не отменен ctx
+func (s *AvatarService) RunUploadPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeExpiredUploads(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[AVATAR] WARNING: failed to purge expired uploads: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("[AVATAR] Purged %d expired uploads", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// ErrInvalidAvatarURL подпись ссылки на аватарку неверна или срок ее действия истек
+var ErrInvalidAvatarURL = errors.New("invalid or expired avatar URL")
+
+// URLStrategy способ построения ссылок на аватарки в ответах API
+type URLStrategy string
+
+const (
+	// URLStrategyPresigned presigned ссылки на объект в хранилище с ограниченным сроком
+	URLStrategyPresigned URLStrategy = "presigned"
+	// URLStrategyPublic постоянные ссылки на публичный bucket (CDN на своем домене)
+	URLStrategyPublic URLStrategy = "public"
+	// URLStrategyProxy ссылки на /avatars/{username} этого сервиса
+	URLStrategyProxy URLStrategy = "proxy"
+)
+
+// ParseURLStrategy проверяет название стратегии из конфигурации
+func ParseURLStrategy(value string) (URLStrategy, error) {
+	switch strategy := URLStrategy(strings.ToLower(value)); strategy {
+	case URLStrategyPresigned, URLStrategyPublic, URLStrategyProxy:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unsupported avatar URL strategy %q: expected presigned, public or proxy", value)
+	}
+}
+
+// URLOptions настройки ссылок на аватарки
+type URLOptions struct {
+	// Strategy способ построения ссылок; по умолчанию URLStrategyPresigned
+	Strategy URLStrategy
+	// PublicBaseURL публичный адрес bucket (например CDN на своем домене) для URLStrategyPublic
+	PublicBaseURL string
+	// ServiceBaseURL внешний адрес этого сервиса для URLStrategyProxy
+	ServiceBaseURL string
+	// PresignExpiry срок действия presigned ссылок; 0 - DefaultPresignExpiry.
+	// Ссылки кэшируются и обновляются каждые PresignExpiry/2
+	PresignExpiry time.Duration
+	// SigningSecret ключ подписи ссылок на аватарки friends и private при
+	// стратегиях public и proxy; ссылки действуют столько же, сколько presigned
+	SigningSecret string
+}
+
+// Validate проверяет, что для выбранной стратегии заданы нужные адреса и ключ подписи.
+// Стратегиям public и proxy адрес сервиса и ключ нужны для аватарок friends и private
+func (o URLOptions) Validate() error {
+	switch o.Strategy {
+	case URLStrategyPublic, URLStrategyProxy:
+		if o.Strategy == URLStrategyPublic && o.PublicBaseURL == "" {
+			return fmt.Errorf("public avatar URL strategy requires a public base URL")
+		}
+		if o.ServiceBaseURL == "" {
+			return fmt.Errorf("%s avatar URL strategy requires a service base URL", o.Strategy)
+		}
+		if o.SigningSecret == "" {
+			return fmt.Errorf("%s avatar URL strategy requires a signing secret", o.Strategy)
+		}
+	}
+	return nil
+}
+
+// objectURL возвращает ссылку на объект аватарки username согласно стратегии.
+// Объекты не изменяются (ключ - хэш содержимого), поэтому ссылки
+// public и proxy содержат идентификатор объекта и могут кэшироваться бессрочно.
+// Бессрочная ссылка продолжала бы работать, когда аватарку скроют, поэтому
+// аватарки friends и private (metadata.Visibility) получают ссылку с ограниченным
+// сроком: presigned или подписанную для viewer (см. viewerAvatarURL)
+func (s *AvatarService) objectURL(ctx context.Context, viewer Viewer, username string, size int, objectID string, metadata *clients.AvatarMetadata) (string, error) {
+	restricted := metadata != nil && !isPublicVisibility(metadata.Visibility)
+	switch {
+	case s.urls.Strategy == URLStrategyPresigned:
+		return s.presignedURL(ctx, objectID)
+	case restricted:
+		return s.viewerAvatarURL(viewer, username, size), nil
+	case s.urls.Strategy == URLStrategyPublic:
+		return s.publicObjectURL(objectID), nil
+	default:
+		return s.proxyObjectURL(username, size, objectID), nil
+	}
+}
+
+// presignedURL возвращает presigned ссылку на объект. Ссылка подписывается
+// временем начала окна кэша и в пределах окна не меняется, новая подписывается
+// до истечения выданной
+func (s *AvatarService) presignedURL(ctx context.Context, objectID string) (string, error) {
+	now := time.Now()
+	if url, ok := s.presigned.get(objectID, now); ok {
+		return url, nil
+	}
+
+	signedAt := s.presigned.windowStart(now)
+	url, err := s.storage.GetAvatarPresignedURL(ctx, objectID, signedAt, int64(s.urls.PresignExpiry/time.Second))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate avatar URL: %w", err)
+	}
+
+	s.presigned.put(objectID, url, now)
+	return url, nil
+}
+
+// publicObjectURL возвращает публичный адрес объекта: ключи в bucket имеют вид avatars/<id>
+func (s *AvatarService) publicObjectURL(objectID string) string {
+	return fmt.Sprintf("%s/avatars/%s", strings.TrimRight(s.urls.PublicBaseURL, "/"), url.PathEscape(objectID))
+}
+
+// proxyObjectURL возвращает адрес /avatars/{username}[/{size}]?v=<объект>.
+// Параметр v меняется вместе с аватаркой, поэтому старые ссылки не отдают новую картинку из кэша
+func (s *AvatarService) proxyObjectURL(username string, size int, objectID string) string {
+	path := "/avatars/" + url.PathEscape(username)
+	if size > 0 {
+		path += "/" + strconv.Itoa(size)
+	}
+	return fmt.Sprintf("%s%s?v=%s", strings.TrimRight(s.urls.ServiceBaseURL, "/"), path, url.QueryEscape(objectID))
+}
+
+// viewerAvatarURL возвращает адрес /avatars/{username}[/{size}], подписанный для
+// viewer: по нему аватарка отдается так, будто ее запросил viewer, поэтому когда
+// аватарку скроют, ссылка начнет отдавать аватарку по умолчанию. Идентификатор
+// объекта в адрес не входит: при стратегии public по нему объект доступен
+// из bucket бессрочно. Срок действия выровнен по окнам presigned ссылок,
+// поэтому в пределах окна адрес не меняется
+func (s *AvatarService) viewerAvatarURL(viewer Viewer, username string, size int) string {
+	path := "/avatars/" + url.PathEscape(username)
+	if size > 0 {
+		path += "/" + strconv.Itoa(size)
+	}
+
+	expires := strconv.FormatInt(s.presigned.windowStart(time.Now()).Add(s.urls.PresignExpiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("viewer", viewer.UserID)
+	query.Set("expires", expires)
+	query.Set("signature", s.signAvatarURL(username, size, viewer.UserID, expires))
+
+	return fmt.Sprintf("%s%s?%s", strings.TrimRight(s.urls.ServiceBaseURL, "/"), path, query.Encode())
+}
+
+// SignedURLViewer проверяет подпись адреса, выданного viewerAvatarURL,
+// и возвращает пользователя, для которого он выдан
+func (s *AvatarService) SignedURLViewer(username string, size int, query url.Values) (Viewer, error) {
+	userID, expires, signature := query.Get("viewer"), query.Get("expires"), query.Get("signature")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || userID == "" || time.Now().Unix() > expiresAt {
+		return Viewer{}, ErrInvalidAvatarURL
+	}
+	expected := s.signAvatarURL(username, size, userID, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return Viewer{}, ErrInvalidAvatarURL
+	}
+	return Viewer{UserID: userID}, nil
+}
+
+func (s *AvatarService) signAvatarURL(username string, size int, userID, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.urls.SigningSecret))
+	mac.Write([]byte(username + "\n" + strconv.Itoa(size) + "\n" + userID + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AvatarRedirectURL возвращает адрес, на который перенаправляется стабильная ссылка
+// на аватарку username (ссылка согласно стратегии).
+// Для пользователей без загрузки или со скрытой от viewer аватаркой - адрес аватарки по умолчанию
+func (s *AvatarService) AvatarRedirectURL(ctx context.Context, viewer Viewer, username string, size int) (string, error) {
+	objectID, metadata, err := s.avatarObjectID(ctx, viewer, username, size)
+	if err != nil {
+		return "", err
+	}
+	return s.objectURL(ctx, viewer, username, size, objectID, metadata)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+const (
+	// userLookups сколько ID пользователей без индекса ищется в UserService параллельно
+	userLookups = 8
+	// batchUserLookups сколько ID без индекса ищется в UserService за один пакетный
+	// запрос, чтобы запрос не порождал неограниченное число обращений к UserService
+	batchUserLookups = 10
+)
+
+// GetAvatarByUserID получает аватарку пользователя по ID из UserService.
+// Работает так же, как GetAvatarByUsername
+func (s *AvatarService) GetAvatarByUserID(ctx context.Context, viewer Viewer, userID string, size int) (AvatarURL, error) {
+	username, err := s.usernameByUserID(ctx, userID)
+	if err != nil {
+		return AvatarURL{}, err
+	}
+	return s.GetAvatarByUsername(ctx, viewer, username, size)
+}
+
+// GetAvatarsByUserIDs получает аватарки для списка ID пользователей.
+// Работает так же, как GetAvatarsByUsernames; неизвестные ID пропускаются.
+// Из ID без индекса в UserService ищутся только первые batchUserLookups и только
+// для аутентифицированного viewer: анонимный запрос не обращается к UserService
+func (s *AvatarService) GetAvatarsByUserIDs(ctx context.Context, viewer Viewer, userIDs []string, size int) (map[string]AvatarURL, error) {
+	usernameMap, err := s.metadata.GetUsernamesByUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// ID, которых нет в индексе (аватарка не загружалась), ищем в UserService
+	var missing []string
+	for _, userID := range userIDs {
+		if _, ok := usernameMap[userID]; !ok && !slices.Contains(missing, userID) {
+			missing = append(missing, userID)
+		}
+	}
+	if viewer.UserID == "" {
+		missing = nil
+	}
+	if len(missing) > batchUserLookups {
+		missing = missing[:batchUserLookups]
+	}
+	for userID, username := range s.lookupUsernames(ctx, missing) {
+		usernameMap[userID] = username
+	}
+
+	usernames := make([]string, 0, len(usernameMap))
+	for _, username := range usernameMap {
+		usernames = append(usernames, username)
+	}
+	avatars, err := s.GetAvatarsByUsernames(ctx, viewer, usernames, size)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]AvatarURL)
+	for userID, username := range usernameMap {
+		if avatar, ok := avatars[username]; ok {
+			result[userID] = avatar
+		}
+	}
+	return result, nil
+}
+
+// usernameByUserID возвращает username по ID: из индекса, при промахе - из UserService
+func (s *AvatarService) usernameByUserID(ctx context.Context, userID string) (string, error) {
+	username, err := s.metadata.GetUsernameByUserID(ctx, userID)
+	if !errors.Is(err, clients.ErrUserIDNotFound) {
+		return username, err
+	}
+	return s.lookupUsername(ctx, userID)
+}
+
+// lookupUsername получает username из UserService. Индекс не изменяется: ответ
+// UserService может опережать необработанное переименование, и запись отняла бы
+// username у прежнего владельца. Псевдонимы записывают только RenameUser и SyncUsername
+func (s *AvatarService) lookupUsername(ctx context.Context, userID string) (string, error) {
+	if s.users == nil {
+		return "", fmt.Errorf("%w: %s", clients.ErrUserIDNotFound, userID)
+	}
+
+	user, err := s.users.GetUserById(ctx, userID)
+	if errors.Is(err, clients.ErrUserNotFound) {
+		return "", fmt.Errorf("%w: %s", clients.ErrUserIDNotFound, userID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+	if user.Username == "" {
+		return "", fmt.Errorf("%w: %s", clients.ErrUserIDNotFound, userID)
+	}
+	return user.Username, nil
+}
+
+// lookupUsernames параллельно ищет username для userIDs в UserService.
+// Ненайденные ID пропускаются
+func (s *AvatarService) lookupUsernames(ctx context.Context, userIDs []string) map[string]string {
+	result := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, userLookups)
+
+	for _, userID := range userIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(userID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			username, err := s.lookupUsername(ctx, userID)
+			if err != nil {
+				if !errors.Is(err, clients.ErrUserIDNotFound) {
+					log.Printf("[AVATAR] WARNING: failed to resolve user id %s: %v", userID, err)
+				}
+				return
+			}
+			mu.Lock()
+			result[userID] = username
+			mu.Unlock()
+		}(userID)
+	}
+
+	wg.Wait()
+	return result
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"sync/atomic"
+	"testing"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+	pb "github.com/S0rgi/Gainly_Avatars/pkg/proto"
+)
+
+// fakeUserService UserService с фиксированными пользователями и дружбой
+type fakeUserService struct {
+	// usernames ID пользователя -> username
+	usernames map[string]string
+	// friends пары "<user_id>/<username>", для которых CheckFriendship успешен
+	friends map[string]bool
+
+	userLookups      atomic.Int32
+	friendshipChecks atomic.Int32
+}
+
+func (f *fakeUserService) ValidateToken(ctx context.Context, token string) (*pb.UserResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeUserService) GetUserById(ctx context.Context, userId string) (*pb.UserResponse, error) {
+	f.userLookups.Add(1)
+	username, ok := f.usernames[userId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", clients.ErrUserNotFound, userId)
+	}
+	return &pb.UserResponse{Id: userId, Username: username}, nil
+}
+
+func (f *fakeUserService) CheckFriendship(ctx context.Context, userId, friendName string) (*pb.FriendshipResponse, error) {
+	f.friendshipChecks.Add(1)
+	if !f.friends[userId+"/"+friendName] {
+		return nil, clients.ErrNotFriends
+	}
+	return &pb.FriendshipResponse{}, nil
+}
+
+func (f *fakeUserService) Close() error {
+	return nil
+}
+
+func TestGetAvatarsByUserIDsLookup(t *testing.T) {
+	ctx := context.Background()
+	service, _, metadata := newTestService(t, RetentionOptions{})
+	service.defaultStyle = imaging.PlaceholderInitials
+
+	addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{R: 255, A: 255}))
+	// alice сменила username на alice2, и alice занял пользователь 4, но событие
+	// смены username еще не обработано
+	users := &fakeUserService{usernames: map[string]string{"1": "alice2", "3": "carol", "4": "alice"}}
+	service.users = users
+
+	// Анонимный запрос не обращается к UserService
+	avatars, err := service.GetAvatarsByUserIDs(ctx, Viewer{}, []string{"1", "3"}, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUserIDs: %v", err)
+	}
+	if _, ok := avatars["1"]; !ok || len(avatars) != 1 {
+		t.Fatalf("anonymous avatars = %v, want only user 1", avatars)
+	}
+	if n := users.userLookups.Load(); n != 0 {
+		t.Fatalf("anonymous request made %d UserService lookups", n)
+	}
+
+	avatars, err = service.GetAvatarsByUserIDs(ctx, Viewer{UserID: "2"}, []string{"1", "3", "4"}, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUserIDs: %v", err)
+	}
+	if !avatars["3"].IsDefault {
+		t.Fatalf("avatars = %v, want default avatar for user 3", avatars)
+	}
+	if n := users.userLookups.Load(); n != 2 {
+		t.Fatalf("UserService lookups = %d, want 2", n)
+	}
+
+	// Поиск не меняет индекс: username alice остается за пользователем 1
+	if _, err := metadata.GetUsernameByUserID(ctx, "3"); !errors.Is(err, clients.ErrUserIDNotFound) {
+		t.Fatalf("GetUsernameByUserID(3) error = %v, want ErrUserIDNotFound", err)
+	}
+	if _, err := metadata.GetUsernameByUserID(ctx, "4"); !errors.Is(err, clients.ErrUserIDNotFound) {
+		t.Fatalf("GetUsernameByUserID(4) error = %v, want ErrUserIDNotFound", err)
+	}
+	if username, err := metadata.GetUsernameByUserID(ctx, "1"); err != nil || username != "alice" {
+		t.Fatalf("GetUsernameByUserID(1) = %q, %v, want alice", username, err)
+	}
+}
+
+func TestCanViewCachesFriendship(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t, RetentionOptions{})
+
+	addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{R: 255, A: 255}))
+	if err := service.SetAvatarVisibility(ctx, "1", clients.AvatarVisibilityFriends); err != nil {
+		t.Fatalf("SetAvatarVisibility: %v", err)
+	}
+	users := &fakeUserService{friends: map[string]bool{"2/alice": true}}
+	service.users = users
+
+	// Повторные запросы одного пользователя проверяют дружбу один раз
+	for i := 0; i < 3; i++ {
+		avatars, err := service.GetAvatarsByUsernames(ctx, Viewer{UserID: "2"}, []string{"alice"}, 0)
+		if err != nil {
+			t.Fatalf("GetAvatarsByUsernames: %v", err)
+		}
+		if avatars["alice"].IsDefault {
+			t.Fatalf("friend got default avatar")
+		}
+	}
+	avatars, err := service.GetAvatarsByUsernames(ctx, Viewer{UserID: "3"}, []string{"alice"}, 0)
+	if err != nil {
+		t.Fatalf("GetAvatarsByUsernames: %v", err)
+	}
+	if _, ok := avatars["alice"]; ok && !avatars["alice"].IsDefault {
+		t.Fatalf("stranger got friends-only avatar")
+	}
+	if n := users.friendshipChecks.Load(); n != 2 {
+		t.Fatalf("CheckFriendship calls = %d, want 2", n)
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+	"github.com/S0rgi/Gainly_Avatars/internal/imaging"
+)
+
+// VariantSizes размеры квадратных копий, создаваемых при загрузке аватарки
+var VariantSizes = []int{64, 128, 256, 512}
+
+// variantID возвращает идентификатор объекта копии заданного размера
+func variantID(objectID string, size int) string {
+	return fmt.Sprintf("%s_%d", objectID, size)
+}
+
+// uploadVariants создает и загружает квадратные копии всех размеров VariantSizes.
+// Изображение не увеличивается: копии больше исходного изображения получают его
+// размер. При ошибке уже загруженные копии удаляются
+func (s *AvatarService) uploadVariants(ctx context.Context, objectID string, img image.Image) ([]int, error) {
+	var uploaded []int
+	side := min(img.Bounds().Dx(), img.Bounds().Dy())
+
+	for _, size := range VariantSizes {
+		data, format, err := s.encoder.Encode(imaging.SquareThumbnail(img, min(size, side)))
+		if err == nil {
+			err = s.storage.UploadAvatar(ctx, variantID(objectID, size), bytes.NewReader(data), format.MimeType(), int64(len(data)))
+		}
+		if err != nil {
+			for _, done := range uploaded {
+				_ = s.storage.DeleteAvatar(ctx, variantID(objectID, done))
+			}
+			return nil, fmt.Errorf("failed to create %dpx variant: %w", size, err)
+		}
+		uploaded = append(uploaded, size)
+	}
+
+	return uploaded, nil
+}
+
+// objectIDForSize возвращает объект, ближайший к запрошенному размеру: наименьшую
+// копию не меньше size, иначе наибольшую. Без копий или при size <= 0 - оригинал
+func objectIDForSize(metadata *clients.AvatarMetadata, size int) string {
+	if size <= 0 || len(metadata.Variants) == 0 {
+		return metadata.StorageID()
+	}
+
+	best := 0
+	for _, variant := range metadata.Variants {
+		switch {
+		case variant >= size && (best < size || variant < best):
+			best = variant
+		case best < size && variant > best:
+			best = variant
+		}
+	}
+	return variantID(metadata.StorageID(), best)
+}
+
+// avatarObjectIDs возвращает все объекты аватарки в хранилище: оригинал и копии
+func avatarObjectIDs(objectID string) []string {
+	ids := []string{objectID}
+	for _, size := range VariantSizes {
+		ids = append(ids, variantID(objectID, size))
+	}
+	return ids
+}
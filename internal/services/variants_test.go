@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"testing"
+)
+
+func TestUploadVariantsDoNotUpscale(t *testing.T) {
+	ctx := context.Background()
+	service, storage, _ := newTestService(t, RetentionOptions{})
+
+	metadata := addAvatar(t, service, "1", "alice", testImage(t, color.RGBA{G: 255, A: 255}))
+
+	// testImage 64x64: копия 64 совпадает с оригиналом, крупные копии не увеличиваются
+	for _, size := range VariantSizes {
+		reader, err := storage.OpenAvatar(ctx, variantID(metadata.ObjectID, size))
+		if err != nil {
+			t.Fatalf("OpenAvatar(%d): %v", size, err)
+		}
+		config, _, err := image.DecodeConfig(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("DecodeConfig(%d): %v", size, err)
+		}
+		want := min(size, 64)
+		if config.Width != want || config.Height != want {
+			t.Errorf("variant %d is %dx%d, want %dx%d", size, config.Width, config.Height, want, want)
+		}
+	}
+
+	if got := objectIDForSize(metadata, 100); got != variantID(metadata.ObjectID, 128) {
+		t.Errorf("objectIDForSize(100) = %s, want 128px variant", got)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/S0rgi/Gainly_Avatars/internal/clients"
+)
+
+// ErrInvalidVisibility неизвестное значение видимости аватарки
+var ErrInvalidVisibility = errors.New("visibility must be public, friends or private")
+
+// friendshipChecks сколько проверок дружбы выполняется параллельно при пакетном запросе
+const friendshipChecks = 8
+
+// Viewer пользователь, запрашивающий аватарку. Нулевое значение - анонимный запрос
+type Viewer struct {
+	UserID string
+}
+
+// SetAvatarVisibility задает, кому видна аватарка пользователя. Настройка хранится
+// в метаданных текущей аватарки и переходит к следующим загрузкам
+func (s *AvatarService) SetAvatarVisibility(ctx context.Context, userID, visibility string) error {
+	switch visibility {
+	case clients.AvatarVisibilityPublic, clients.AvatarVisibilityFriends, clients.AvatarVisibilityPrivate:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidVisibility, visibility)
+	}
+
+	guid, err := s.metadata.GetGUIDByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	metadata, err := s.metadata.GetAvatarMetadata(ctx, guid)
+	if err != nil {
+		return err
+	}
+
+	metadata.Visibility = visibility
+	if err := s.metadata.SetAvatarMetadata(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
+
+// currentVisibility возвращает видимость текущей аватарки пользователя
+// или пустую строку, если аватарки нет
+func (s *AvatarService) currentVisibility(ctx context.Context, userID string) string {
+	guid, err := s.metadata.GetGUIDByUserID(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	metadata, err := s.metadata.GetAvatarMetadata(ctx, guid)
+	if err != nil {
+		return ""
+	}
+	return metadata.Visibility
+}
+
+// canView проверяет, что viewer может видеть аватарку владельца с текущим username
+// owner. Владелец (по ID) видит свою аватарку всегда, friends требует дружбы
+// по CheckFriendship; результат проверки кэшируется на friendshipCacheTTL.
+// При ошибке проверки аватарка считается скрытой
+func (s *AvatarService) canView(ctx context.Context, viewer Viewer, owner string, metadata *clients.AvatarMetadata) bool {
+	if isPublicVisibility(metadata.Visibility) {
+		return true
+	}
+	if viewer.UserID != "" && viewer.UserID == metadata.UserID {
+		return true
+	}
+	if metadata.Visibility != clients.AvatarVisibilityFriends || viewer.UserID == "" || s.users == nil {
+		return false
+	}
+
+	if friends, ok := s.friendships.get(viewer.UserID, owner, time.Now()); ok {
+		return friends
+	}
+
+	// metadata.Username - username на момент загрузки, он мог смениться
+	_, err := s.users.CheckFriendship(ctx, viewer.UserID, owner)
+	if err != nil && !errors.Is(err, clients.ErrNotFriends) {
+		// Ошибка проверки не кэшируется
+		log.Printf("[AVATAR] WARNING: failed to check friendship %s -> %s: %v", viewer.UserID, owner, err)
+		return false
+	}
+	s.friendships.put(viewer.UserID, owner, err == nil, time.Now())
+	return err == nil
+}
+
+// isPublicVisibility проверяет, что аватарка видна всем. Пустая видимость
+// у аватарок, загруженных до появления настройки
+func isPublicVisibility(visibility string) bool {
+	return visibility == "" || visibility == clients.AvatarVisibilityPublic
+}
+
+// hiddenAvatars возвращает GUID аватарок из guidMap (username -> GUID), которые
+// не видны viewer. Дружба проверяется параллельно
+func (s *AvatarService) hiddenAvatars(ctx context.Context, viewer Viewer, guidMap map[string]string, metadataMap map[string]*clients.AvatarMetadata) map[string]bool {
+	hidden := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, friendshipChecks)
+
+	for username, guid := range guidMap {
+		metadata, ok := metadataMap[guid]
+		if !ok || isPublicVisibility(metadata.Visibility) {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(username, guid string, metadata *clients.AvatarMetadata) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if !s.canView(ctx, viewer, username, metadata) {
+				mu.Lock()
+				hidden[guid] = true
+				mu.Unlock()
+			}
+		}(username, guid, metadata)
+	}
+
+	wg.Wait()
+	return hidden
+}